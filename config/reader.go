@@ -1,20 +1,38 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
 
-func Read() Config {
+	"github.com/spf13/viper"
+)
+
+// Read читает ./config/config.json и проверяет его. Ошибка проверки — *ValidationError со всеми проблемами
+func Read() (Config, error) {
+	settings, err := Load()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := settings.Validate(); err != nil {
+		return Config{}, err
+	}
+	return settings, nil
+}
+
+// Load читает ./config/config.json, не проверяя значения, см. Validate
+func Load() (Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
 	viper.AddConfigPath("./config")
 
 	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
+		return Config{}, fmt.Errorf("unable to read config: %w", err)
 	}
 
 	var settings Config
 	if err := viper.Unmarshal(&settings); err != nil {
-		panic(err)
+		return Config{}, fmt.Errorf("unable to parse config: %w", err)
 	}
+	settings.Urls = settings.Urls.withBaseUrl()
 
-	return settings
+	return settings, nil
 }
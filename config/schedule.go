@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule — расписание одной задачи. Незаданные поля берутся из расписания уровнем выше:
+// магазин -> Schedules -> DefaultSchedules
+type Schedule struct {
+	Cron         string        // cron с секундами или дескриптор вида "@every 10m"
+	Jitter       time.Duration // случайная задержка запуска от 0 до Jitter
+	RunOnStartup *bool         // запустить сразу при старте, не дожидаясь расписания
+	Overlap      string        // если прошлый запуск ещё идёт: skip — пропустить, queue — дождаться. Пустое — skip
+}
+
+// Расписания задач демона. У магазина переопределяются только Totals и Items
+type Schedules struct {
+	Totals         Schedule // итоговые метрики магазинов
+	Items          Schedule // метрики по объявлениям
+	Snapshots      Schedule // проверка слотов снапшотов
+	ClearSnapshots Schedule // очистка диапазонов снапшотов
+}
+
+var DefaultSchedules = Schedules{
+	Totals:         Schedule{Cron: "@every 10m", RunOnStartup: boolPtr(true)},
+	Items:          Schedule{Cron: "0 0 * * * *", RunOnStartup: boolPtr(false)},
+	Snapshots:      Schedule{Cron: "0 * * * * *", RunOnStartup: boolPtr(true)}, // при старте догоняет пропущенные слоты
+	ClearSnapshots: Schedule{Cron: "0 0 0 * * *", RunOnStartup: boolPtr(false)},
+}
+
+// cronParser разбирает выражения так же, как cron.WithSeconds в планировщике
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Merge возвращает s, в котором заданные поля over заменили свои
+func (s Schedule) Merge(over Schedule) Schedule {
+	if over.Cron != "" {
+		s.Cron = over.Cron
+	}
+	if over.Jitter > 0 {
+		s.Jitter = over.Jitter
+	}
+	if over.RunOnStartup != nil {
+		s.RunOnStartup = over.RunOnStartup
+	}
+	if over.Overlap != "" {
+		s.Overlap = over.Overlap
+	}
+	return s
+}
+
+func (s Schedule) StartsImmediately() bool {
+	return s.RunOnStartup != nil && *s.RunOnStartup
+}
+
+func (s Schedule) validate() error {
+	if _, err := cronParser.Parse(s.Cron); err != nil {
+		return fmt.Errorf("invalid cron %q: %w", s.Cron, err)
+	}
+	if s.Jitter < 0 {
+		return fmt.Errorf("negative jitter %s", s.Jitter)
+	}
+	if s.Overlap != "" && s.Overlap != "skip" && s.Overlap != "queue" {
+		return fmt.Errorf("invalid overlap %q, must be skip or queue", s.Overlap)
+	}
+	return nil
+}
+
+// JobSchedules — итоговые расписания задач с учётом значений по умолчанию
+func (c Config) JobSchedules() Schedules {
+	return Schedules{
+		Totals:         DefaultSchedules.Totals.Merge(c.Schedules.Totals),
+		Items:          DefaultSchedules.Items.Merge(c.Schedules.Items),
+		Snapshots:      DefaultSchedules.Snapshots.Merge(c.Schedules.Snapshots),
+		ClearSnapshots: DefaultSchedules.ClearSnapshots.Merge(c.Schedules.ClearSnapshots),
+	}
+}
+
+// ShopSchedules — расписания магазина: общие с переопределёнными Totals и Items
+func (c Config) ShopSchedules(shop Shop) Schedules {
+	s := c.JobSchedules()
+	s.Totals = s.Totals.Merge(shop.Schedules.Totals)
+	s.Items = s.Items.Merge(shop.Schedules.Items)
+	return s
+}
+
+// ValidateSchedules проверяет выражения и задержки всех расписаний, включая переопределения магазинов
+func (c Config) ValidateSchedules() []error {
+	var errs []error
+	for _, p := range c.scheduleProblems() {
+		errs = append(errs, errors.New(p.String()))
+	}
+	return errs
+}
+
+func (c Config) scheduleProblems() []Problem {
+	var problems []Problem
+	check := func(path string, s Schedule) {
+		if err := s.validate(); err != nil {
+			problems = append(problems, Problem{Path: path, Message: err.Error()})
+		}
+	}
+
+	jobs := c.JobSchedules()
+	check("Schedules.Totals", jobs.Totals)
+	check("Schedules.Items", jobs.Items)
+	check("Schedules.Snapshots", jobs.Snapshots)
+	check("Schedules.ClearSnapshots", jobs.ClearSnapshots)
+
+	for i, shop := range c.Shops {
+		path := fmt.Sprintf("Shops[%d].Schedules", i)
+		if shop.Schedules.Snapshots != (Schedule{}) || shop.Schedules.ClearSnapshots != (Schedule{}) {
+			problems = append(problems, Problem{Path: path, Message: "only Totals and Items schedules can be overridden"})
+		}
+		// ошибки общих расписаний уже найдены выше, здесь — только переопределения магазина
+		s := c.ShopSchedules(shop)
+		if shop.Schedules.Totals != (Schedule{}) {
+			check(path+".Totals", s.Totals)
+		}
+		if shop.Schedules.Items != (Schedule{}) {
+			check(path+".Items", s.Items)
+		}
+	}
+	return problems
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,23 @@
+package config
+
+import "avitoproject/internal/clock"
+
+// Zones загружает общий часовой пояс и пояса магазинов
+func (c Config) Zones() (*clock.Zones, error) {
+	shops := make(map[string]string, len(c.Shops))
+	for _, shop := range c.Shops {
+		shops[shop.Name] = shop.Timezone
+	}
+	return clock.NewZones(c.Timezone, shops)
+}
+
+// ShopTimezone — имя пояса магазина с учётом общего Timezone, пустое — clock.DefaultZone
+func (c Config) ShopTimezone(shop Shop) string {
+	if shop.Timezone != "" {
+		return shop.Timezone
+	}
+	if c.Timezone != "" {
+		return c.Timezone
+	}
+	return clock.DefaultZone
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"avitoproject/internal/a1"
+	"avitoproject/internal/clock"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// totalsRows — сколько значений итогов пишется в SheetRange колонкой: расход, показы, просмотры, контакты.
+// Снапшот копирует их строкой, поэтому в диапазоне слота нужно столько же колонок
+const totalsRows = 4
+
+// Problem — одна ошибка конфига: путь к полю в config.json, например "Shops[1].Snapshots[0].Time", и что не так
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError — все ошибки конфига, найденные Validate, по строке на ошибку
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate проверяет обязательные поля и согласованность настроек.
+// Возвращает *ValidationError со всеми найденными ошибками сразу, а не только с первой
+func (c Config) Validate() error {
+	var problems []Problem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(c.Shops) == 0 {
+		add("Shops", "no shops configured")
+	}
+
+	names := make(map[string]int, len(c.Shops))
+	usesSheets := false
+	for i, shop := range c.Shops {
+		path := fmt.Sprintf("Shops[%d]", i)
+		if shop.Name == "" {
+			add(path+".Name", "is required")
+		} else if first, ok := names[shop.Name]; ok {
+			// по имени ищется диапазон магазина при записи итогов, дубль пишет в чужой диапазон
+			add(path+".Name", "duplicate shop name %q, already used by Shops[%d]", shop.Name, first)
+		} else {
+			names[shop.Name] = i
+		}
+
+		if shop.ClientId == "" {
+			add(path+".ClientId", "is required")
+		}
+		if shop.ClientSecret == "" {
+			add(path+".ClientSecret", "is required")
+		}
+		if shop.UserId <= 0 {
+			add(path+".UserId", "must be positive, got %d", shop.UserId)
+		}
+		if shop.RetryBudget < 0 {
+			add(path+".RetryBudget", "must not be negative, got %d", shop.RetryBudget)
+		}
+
+		if shop.Timezone != "" {
+			if _, err := clock.Load(shop.Timezone); err != nil {
+				add(path+".Timezone", "%v", err)
+			}
+		}
+
+		sinks := c.shopSinks(shop)
+		for j, sink := range sinks {
+			if sink == "sheets" {
+				usesSheets = true
+			}
+			// общий Sinks проверяется ниже один раз
+			if len(shop.Sinks) > 0 {
+				if err := c.checkSink(sink); err != nil {
+					add(fmt.Sprintf("%s.Sinks[%d]", path, j), "%v", err)
+				}
+			}
+		}
+		if slices.Contains(sinks, "sheets") && shop.SheetRange == "" {
+			add(path+".SheetRange", "is required for sink sheets")
+		}
+		if shop.SheetRange != "" {
+			if r, ok := checkRange(add, path+".SheetRange", shop.SheetRange); ok && r.R2 >= 0 && r.R2-r.R1+1 < totalsRows {
+				add(path+".SheetRange", "range %q is too small: totals are written as a column of %d values", shop.SheetRange, totalsRows)
+			}
+		}
+		if shop.ItemsSheetRange != "" {
+			checkRange(add, path+".ItemsSheetRange", shop.ItemsSheetRange)
+		}
+
+		slots := make(map[string]int, len(shop.Snapshots))
+		for j, snap := range shop.Snapshots {
+			snapPath := fmt.Sprintf("%s.Snapshots[%d]", path, j)
+			if _, err := time.Parse("15:04", snap.Time); err != nil || len(snap.Time) != 5 {
+				// слоты сравниваются как строки "HH:MM", "9:00" никогда не совпадёт с "09:00"
+				add(snapPath+".Time", "snapshot time %q must be HH:MM with leading zeros, e.g. \"09:00\"", snap.Time)
+			} else if first, ok := slots[snap.Time]; ok {
+				add(snapPath+".Time", "duplicate snapshot slot %s, already used by Snapshots[%d]", snap.Time, first)
+			} else {
+				slots[snap.Time] = j
+			}
+
+			if snap.Range == "" {
+				add(snapPath+".Range", "is required")
+			} else if r, ok := checkRange(add, snapPath+".Range", snap.Range); ok && r.C2 >= 0 && r.C2-r.C1+1 < totalsRows {
+				add(snapPath+".Range", "range %q is too small: a snapshot is written as a row of %d values", snap.Range, totalsRows)
+			}
+		}
+	}
+
+	if usesSheets && c.SheetId == "" {
+		add("SheetId", "is required for sink sheets")
+	}
+	if c.HistoryRange != "" {
+		checkRange(add, "HistoryRange", c.HistoryRange)
+	}
+	if c.SnapshotArchiveRange != "" {
+		checkRange(add, "SnapshotArchiveRange", c.SnapshotArchiveRange)
+	}
+	problems = append(problems, c.rangeOverlaps()...)
+
+	for i, sink := range c.Sinks {
+		if err := c.checkSink(sink); err != nil {
+			add(fmt.Sprintf("Sinks[%d]", i), "%v", err)
+		}
+	}
+	if _, err := clock.Load(c.Timezone); err != nil {
+		add("Timezone", "%v", err)
+	}
+	problems = append(problems, c.scheduleProblems()...)
+
+	if c.Admin.Addr != "" && c.Admin.Token == "" {
+		add("Admin.Token", "is required when Admin.Addr is set")
+	}
+	if c.ShutdownTimeout < 0 {
+		add("ShutdownTimeout", "must not be negative, got %s", c.ShutdownTimeout)
+	}
+	if c.SnapshotCatchUp.Grace < 0 {
+		add("SnapshotCatchUp.Grace", "must not be negative, got %s", c.SnapshotCatchUp.Grace)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// withBaseUrl — u с AvitoBaseUrl, взятым из устаревших TokenUrl или MetricsUrl, если он не задан
+func (u Url) withBaseUrl() Url {
+	switch {
+	case u.AvitoBaseUrl != "":
+	case u.TokenUrl != "":
+		u.AvitoBaseUrl = baseUrl(u.TokenUrl)
+	case u.MetricsUrl != "":
+		u.AvitoBaseUrl = baseUrl(u.MetricsUrl)
+	}
+	return u
+}
+
+// baseUrl — схема и хост старого адреса эндпоинта, например https://api.avito.ru из https://api.avito.ru/token
+func baseUrl(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "https://api.avito.ru"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// checkRange разбирает диапазон A1 и добавляет ошибку по path, если он некорректен
+func checkRange(add func(path, format string, args ...interface{}), path, value string) (a1.Range, bool) {
+	r, err := a1.Parse(value)
+	if err != nil {
+		add(path, "invalid A1 range %q: %v", value, err)
+		return a1.Range{}, false
+	}
+	return r, true
+}
+
+// rangeOverlaps ищет диапазоны таблицы, в которые пишут разные выгрузки: итоги, объявления и слоты
+// разных магазинов, а также историю и архив снапшотов. Запись в общий диапазон затирает чужие данные
+func (c Config) rangeOverlaps() []Problem {
+	type owned struct {
+		path  string
+		value string
+		r     a1.Range
+	}
+	var ranges []owned
+	addRange := func(path, value string) {
+		if value == "" {
+			return
+		}
+		if r, err := a1.Parse(value); err == nil {
+			ranges = append(ranges, owned{path: path, value: value, r: r})
+		}
+	}
+	for i, shop := range c.Shops {
+		path := fmt.Sprintf("Shops[%d]", i)
+		addRange(path+".SheetRange", shop.SheetRange)
+		addRange(path+".ItemsSheetRange", shop.ItemsSheetRange)
+		for j, snap := range shop.Snapshots {
+			addRange(fmt.Sprintf("%s.Snapshots[%d].Range", path, j), snap.Range)
+		}
+	}
+	addRange("HistoryRange", c.HistoryRange)
+	addRange("SnapshotArchiveRange", c.SnapshotArchiveRange)
+
+	var problems []Problem
+	for i := range ranges {
+		for k := 0; k < i; k++ {
+			if ranges[i].r.Overlaps(ranges[k].r) {
+				problems = append(problems, Problem{
+					Path:    ranges[i].path,
+					Message: fmt.Sprintf("range %q overlaps %s (%q)", ranges[i].value, ranges[k].path, ranges[k].value),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// shopSinks — sinks магазина с учётом общего Sinks и значения по умолчанию
+func (c Config) shopSinks(shop Shop) []string {
+	if len(shop.Sinks) > 0 {
+		return shop.Sinks
+	}
+	if len(c.Sinks) > 0 {
+		return c.Sinks
+	}
+	return []string{"sheets"}
+}
+
+// SnapshotsArchived — сохраняются ли снапшоты магазина где-то кроме диапазонов слотов,
+// которые каждую ночь очищаются: в SnapshotArchiveRange или в sinks history и postgres
+func (c Config) SnapshotsArchived(shop Shop) bool {
+	if c.SnapshotArchiveRange != "" {
+		return true
+	}
+	sinks := c.shopSinks(shop)
+	return slices.Contains(sinks, "history") || slices.Contains(sinks, "postgres")
+}
+
+// Warnings — настройки, с которыми демон работает, но, скорее всего, не так, как задумано
+func (c Config) Warnings() []Problem {
+	var warnings []Problem
+	deprecated := func(path, value string) {
+		if value != "" {
+			warnings = append(warnings, Problem{
+				Path:    path,
+				Message: fmt.Sprintf("deprecated, set Urls.AvitoBaseUrl instead, e.g. %q", baseUrl(value)),
+			})
+		}
+	}
+	deprecated("Urls.TokenUrl", c.Urls.TokenUrl)
+	deprecated("Urls.MetricsUrl", c.Urls.MetricsUrl)
+
+	for i, shop := range c.Shops {
+		if len(shop.Snapshots) > 0 && slices.Contains(c.shopSinks(shop), "sheets") && !c.SnapshotsArchived(shop) {
+			warnings = append(warnings, Problem{
+				Path:    fmt.Sprintf("Shops[%d].Snapshots", i),
+				Message: "snapshot ranges are never cleared: no SnapshotArchiveRange and neither history nor postgres sink is enabled",
+			})
+		}
+	}
+	return warnings
+}
+
+// UsesSink — включён ли sink хотя бы у одного магазина
+func (c Config) UsesSink(name string) bool {
+	for _, shop := range c.Shops {
+		if slices.Contains(c.shopSinks(shop), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) checkSink(name string) error {
+	switch name {
+	case "sheets":
+		return nil
+	case "history":
+		if c.HistoryDir == "" {
+			return errors.New("sink history requires HistoryDir")
+		}
+	case "csv":
+		if c.Csv.Dir == "" {
+			return errors.New("sink csv requires Csv.Dir")
+		}
+	case "webhook":
+		if c.Webhook.Url == "" {
+			return errors.New("sink webhook requires Webhook.Url")
+		}
+	case "postgres":
+		if c.Postgres.Dsn == "" {
+			return errors.New("sink postgres requires Postgres.Dsn")
+		}
+	default:
+		return fmt.Errorf("unknown sink %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// validConfig — минимальный корректный конфиг: один магазин с итогами и двумя слотами снапшотов
+func validConfig() Config {
+	return Config{
+		SheetId: "sheet",
+		Shops: []Shop{{
+			Name:         "main",
+			ClientId:     "client",
+			ClientSecret: "secret",
+			UserId:       1,
+			SheetRange:   "Totals!B2:B5",
+			Snapshots: []SnapshotTime{
+				{Time: "10:00", Range: "Snapshots!B2:E2"},
+				{Time: "14:00", Range: "Snapshots!B3:E3"},
+			},
+		}},
+		SnapshotArchiveRange: "Archive!A:H",
+	}
+}
+
+// problemPaths — пути ошибок Validate по порядку, nil — конфиг корректен
+func problemPaths(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate returned %T, want *ValidationError: %v", err, err)
+	}
+	paths := make([]string, 0, len(verr.Problems))
+	for _, p := range verr.Problems {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		want []string // пути ошибок по порядку
+	}{
+		{name: "valid", edit: func(c *Config) {}},
+		{name: "no shops", edit: func(c *Config) { c.Shops = nil }, want: []string{"Shops"}},
+		{name: "missing credentials", edit: func(c *Config) {
+			c.Shops[0].Name, c.Shops[0].ClientId, c.Shops[0].ClientSecret, c.Shops[0].UserId = "", "", "", 0
+		}, want: []string{"Shops[0].Name", "Shops[0].ClientId", "Shops[0].ClientSecret", "Shops[0].UserId"}},
+		{name: "duplicate shop name", edit: func(c *Config) {
+			second := c.Shops[0]
+			second.SheetRange, second.Snapshots = "Totals!C2:C5", nil
+			c.Shops = append(c.Shops, second)
+		}, want: []string{"Shops[1].Name"}},
+		{name: "negative retry budget", edit: func(c *Config) { c.Shops[0].RetryBudget = -1 }, want: []string{"Shops[0].RetryBudget"}},
+		{name: "unknown timezones", edit: func(c *Config) {
+			c.Timezone = "Mars/Olympus"
+			c.Shops[0].Timezone = "Europe/Nowhere"
+		}, want: []string{"Shops[0].Timezone", "Timezone"}},
+		{name: "sheets without sheet id and range", edit: func(c *Config) {
+			c.SheetId = ""
+			c.Shops[0].SheetRange = ""
+		}, want: []string{"Shops[0].SheetRange", "SheetId"}},
+		{name: "history only needs no sheet", edit: func(c *Config) {
+			c.SheetId, c.SnapshotArchiveRange = "", ""
+			c.Sinks, c.HistoryDir = []string{"history"}, "/var/lib/avito"
+			c.Shops[0].SheetRange = ""
+		}},
+		{name: "sink settings", edit: func(c *Config) {
+			c.Sinks = []string{"sheets", "csv", "kafka"}
+			c.Shops[0].Sinks = []string{"sheets", "webhook"}
+		}, want: []string{"Shops[0].Sinks[1]", "Sinks[1]", "Sinks[2]"}},
+		{name: "totals range too small", edit: func(c *Config) { c.Shops[0].SheetRange = "Totals!B2:B3" }, want: []string{"Shops[0].SheetRange"}},
+		{name: "invalid ranges", edit: func(c *Config) {
+			c.Shops[0].ItemsSheetRange = "Items!A2:!"
+			c.HistoryRange = "History!"
+		}, want: []string{"Shops[0].ItemsSheetRange", "HistoryRange"}},
+		{name: "bad snapshot times", edit: func(c *Config) {
+			c.Shops[0].Snapshots = []SnapshotTime{
+				{Time: "9:00", Range: "Snapshots!B2:E2"},
+				{Time: "25:00", Range: "Snapshots!B3:E3"},
+				{Time: "14:00", Range: "Snapshots!B4:E4"},
+				{Time: "14:00", Range: "Snapshots!B5:E5"},
+			}
+		}, want: []string{"Shops[0].Snapshots[0].Time", "Shops[0].Snapshots[1].Time", "Shops[0].Snapshots[3].Time"}},
+		{name: "snapshot ranges", edit: func(c *Config) {
+			c.Shops[0].Snapshots[0].Range = ""
+			c.Shops[0].Snapshots[1].Range = "Snapshots!B3:D3"
+		}, want: []string{"Shops[0].Snapshots[0].Range", "Shops[0].Snapshots[1].Range"}},
+		{name: "overlapping ranges", edit: func(c *Config) {
+			c.Shops[0].Snapshots[1].Range = "Snapshots!C2:F2"
+			c.SnapshotArchiveRange = "Totals!A:H"
+		}, want: []string{"Shops[0].Snapshots[1].Range", "SnapshotArchiveRange"}},
+		// устаревшие адреса — предупреждение, а не ошибка: старый конфиг запускается, см. TestDeprecatedUrls
+		{name: "deprecated urls", edit: func(c *Config) {
+			c.Urls.TokenUrl = "https://api.avito.ru/token"
+			c.Urls.MetricsUrl = "https://api.avito.ru/stats/v2"
+		}},
+		{name: "invalid schedules", edit: func(c *Config) {
+			c.Schedules.Totals.Cron = "every ten minutes"
+			c.Schedules.Items.Overlap = "parallel"
+			c.Shops[0].Schedules.Snapshots.Cron = "@every 1m"
+			c.Shops[0].Schedules.Totals.Jitter = -time.Second
+		}, want: []string{"Schedules.Totals", "Schedules.Items", "Shops[0].Schedules", "Shops[0].Schedules.Totals"}},
+		{name: "admin without token", edit: func(c *Config) { c.Admin.Addr = ":8081" }, want: []string{"Admin.Token"}},
+		{name: "negative durations", edit: func(c *Config) {
+			c.ShutdownTimeout = -time.Second
+			c.SnapshotCatchUp.Grace = -time.Minute
+		}, want: []string{"ShutdownTimeout", "SnapshotCatchUp.Grace"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(&cfg)
+			got := problemPaths(t, cfg.Validate())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %v, want %v\n%v", got, tt.want, cfg.Validate())
+			}
+		})
+	}
+}
+
+func TestDeprecatedUrls(t *testing.T) {
+	tests := []struct {
+		name     string
+		urls     Url
+		wantBase string
+		warnings []string
+	}{
+		{name: "new config", urls: Url{AvitoBaseUrl: "https://proxy.local"}, wantBase: "https://proxy.local"},
+		{name: "default", urls: Url{}, wantBase: ""},
+		{name: "old config", urls: Url{TokenUrl: "https://api.avito.ru/token", MetricsUrl: "https://api.avito.ru/stats/v1/accounts"},
+			wantBase: "https://api.avito.ru", warnings: []string{"Urls.TokenUrl", "Urls.MetricsUrl"}},
+		{name: "only metrics url", urls: Url{MetricsUrl: "http://localhost:8080/stats"},
+			wantBase: "http://localhost:8080", warnings: []string{"Urls.MetricsUrl"}},
+		{name: "base url wins", urls: Url{AvitoBaseUrl: "https://proxy.local", TokenUrl: "https://api.avito.ru/token"},
+			wantBase: "https://proxy.local", warnings: []string{"Urls.TokenUrl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Urls = tt.urls.withBaseUrl()
+			if cfg.Urls.AvitoBaseUrl != tt.wantBase {
+				t.Errorf("AvitoBaseUrl = %q, want %q", cfg.Urls.AvitoBaseUrl, tt.wantBase)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			var got []string
+			for _, w := range cfg.Warnings() {
+				got = append(got, w.Path)
+			}
+			if !reflect.DeepEqual(got, tt.warnings) {
+				t.Errorf("warnings = %v, want %v", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		want []Problem
+	}{
+		{name: "no overlaps", edit: func(c *Config) {}},
+		{name: "slots of one shop", edit: func(c *Config) { c.Shops[0].Snapshots[1].Range = "Snapshots!E2:H2" }, want: []Problem{{
+			Path:    "Shops[0].Snapshots[1].Range",
+			Message: `range "Snapshots!E2:H2" overlaps Shops[0].Snapshots[0].Range ("Snapshots!B2:E2")`,
+		}}},
+		{name: "items below totals", edit: func(c *Config) { c.Shops[0].ItemsSheetRange = "Totals!A5:O" }, want: []Problem{{
+			Path:    "Shops[0].ItemsSheetRange",
+			Message: `range "Totals!A5:O" overlaps Shops[0].SheetRange ("Totals!B2:B5")`,
+		}}},
+		{name: "items apart from totals", edit: func(c *Config) { c.Shops[0].ItemsSheetRange = "Totals!A6:O" }},
+		{name: "two shops", edit: func(c *Config) {
+			c.Shops = append(c.Shops, Shop{Name: "second", SheetRange: "Totals!A1:C2"})
+		}, want: []Problem{{
+			Path:    "Shops[1].SheetRange",
+			Message: `range "Totals!A1:C2" overlaps Shops[0].SheetRange ("Totals!B2:B5")`,
+		}}},
+		{name: "history over whole sheet", edit: func(c *Config) {
+			c.HistoryRange = "Snapshots"
+		}, want: []Problem{
+			{Path: "HistoryRange", Message: `range "Snapshots" overlaps Shops[0].Snapshots[0].Range ("Snapshots!B2:E2")`},
+			{Path: "HistoryRange", Message: `range "Snapshots" overlaps Shops[0].Snapshots[1].Range ("Snapshots!B3:E3")`},
+		}},
+		{name: "other sheet", edit: func(c *Config) { c.HistoryRange = "History!A:G" }},
+		{name: "invalid ranges are skipped", edit: func(c *Config) { c.HistoryRange = "Totals!" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(&cfg)
+			if got := cfg.rangeOverlaps(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rangeOverlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package a1 разбирает диапазоны Google Sheets в нотации A1: "Лист!A1:C3", "'Мой лист'!B2",
+// "Лист!A:G", "Лист!2:5", "A1" (лист DefaultSheet) и "Лист" (весь лист)
+package a1
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultSheet — лист для диапазонов без имени листа
+const DefaultSheet = "Sheet1"
+
+// Range — прямоугольник ячеек листа, строки и колонки с нуля, границы включительно.
+// R2, C2 == -1 — без ограничения
+type Range struct {
+	Sheet          string
+	R1, C1, R2, C2 int
+}
+
+func (r Range) Contains(row, col int) bool {
+	return row >= r.R1 && col >= r.C1 &&
+		(r.R2 < 0 || row <= r.R2) && (r.C2 < 0 || col <= r.C2)
+}
+
+// Overlaps — есть ли у диапазонов общие ячейки
+func (r Range) Overlaps(o Range) bool {
+	if r.Sheet != o.Sheet {
+		return false
+	}
+	return (r.R2 < 0 || o.R1 <= r.R2) && (o.R2 < 0 || r.R1 <= o.R2) &&
+		(r.C2 < 0 || o.C1 <= r.C2) && (o.C2 < 0 || r.C1 <= o.C2)
+}
+
+func (r Range) String() string {
+	if r.R1 == 0 && r.C1 == 0 && r.R2 < 0 && r.C2 < 0 {
+		return r.Sheet
+	}
+	ref := func(row, col int) string {
+		s := ""
+		if col >= 0 {
+			s = ColName(col)
+		}
+		if row >= 0 {
+			s += strconv.Itoa(row + 1)
+		}
+		return s
+	}
+	return fmt.Sprintf("%s!%s:%s", r.Sheet, ref(r.R1, r.C1), ref(r.R2, r.C2))
+}
+
+// Parse разбирает диапазон в нотации A1
+func Parse(s string) (Range, error) {
+	if strings.TrimSpace(s) == "" {
+		return Range{}, errors.New("empty range")
+	}
+	sheet, cells := DefaultSheet, s
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		sheet, cells = s[:i], s[i+1:]
+		if len(sheet) >= 2 && sheet[0] == '\'' && sheet[len(sheet)-1] == '\'' {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		} else if strings.ContainsAny(sheet, "!'") {
+			// такие символы допустимы только в имени листа в кавычках
+			return Range{}, fmt.Errorf("unable to parse range: %q", s)
+		}
+		if cells == "" {
+			return Range{}, fmt.Errorf("unable to parse range: %q", s)
+		}
+	} else if _, _, err := parseRef(strings.Split(s, ":")[0]); err != nil {
+		// без "!" и не похоже на ячейки — это имя листа целиком
+		return Range{Sheet: s, R2: -1, C2: -1}, nil
+	}
+	if sheet == "" {
+		return Range{}, fmt.Errorf("unable to parse range: %q", s)
+	}
+
+	from, to, found := strings.Cut(cells, ":")
+	r1, c1, err := parseRef(from)
+	if err != nil {
+		return Range{}, fmt.Errorf("unable to parse range: %q", s)
+	}
+	r2, c2 := r1, c1
+	if found {
+		if r2, c2, err = parseRef(to); err != nil {
+			return Range{}, fmt.Errorf("unable to parse range: %q", s)
+		}
+	}
+
+	r := Range{Sheet: sheet, R1: max(r1, 0), C1: max(c1, 0), R2: r2, C2: c2}
+	if (r.R2 >= 0 && r.R2 < r.R1) || (r.C2 >= 0 && r.C2 < r.C1) {
+		return Range{}, fmt.Errorf("unable to parse range: %q", s)
+	}
+	return r, nil
+}
+
+// parseRef разбирает ссылку вида "B12", "B" или "12". Отсутствующие строка или колонка — -1
+func parseRef(s string) (row, col int, err error) {
+	i := 0
+	for i < len(s) && (s[i] >= 'A' && s[i] <= 'Z' || s[i] >= 'a' && s[i] <= 'z') {
+		i++
+	}
+	letters, digits := strings.ToUpper(s[:i]), s[i:]
+	if letters == "" && digits == "" {
+		return 0, 0, errors.New("empty reference")
+	}
+	if len(letters) > 3 { // последняя колонка Sheets — ZZZ
+		return 0, 0, fmt.Errorf("invalid column %q", letters)
+	}
+
+	col = -1
+	if letters != "" {
+		col = 0
+		for _, ch := range letters {
+			col = col*26 + int(ch-'A'+1)
+		}
+		col--
+	}
+	row = -1
+	if digits != "" {
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid row %q", digits)
+		}
+		row = n - 1
+	}
+	return row, col, nil
+}
+
+// ColName — имя колонки по номеру с нуля: 0 -> A, 26 -> AA
+func ColName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,97 @@
+package a1
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Range
+		wantErr bool
+	}{
+		{in: "Totals!B2:B5", want: Range{Sheet: "Totals", R1: 1, C1: 1, R2: 4, C2: 1}},
+		{in: "Totals!b2:b5", want: Range{Sheet: "Totals", R1: 1, C1: 1, R2: 4, C2: 1}},
+		{in: "Snapshots!B2", want: Range{Sheet: "Snapshots", R1: 1, C1: 1, R2: 1, C2: 1}},
+		{in: "Items!A2:O", want: Range{Sheet: "Items", R1: 1, C1: 0, R2: -1, C2: 14}},
+		{in: "Archive!A:H", want: Range{Sheet: "Archive", R1: 0, C1: 0, R2: -1, C2: 7}},
+		{in: "History!2:5", want: Range{Sheet: "History", R1: 1, C1: 0, R2: 4, C2: -1}},
+		{in: "Wide!AA1:ZZZ2", want: Range{Sheet: "Wide", R1: 0, C1: 26, R2: 1, C2: 18277}},
+		{in: "A1:C3", want: Range{Sheet: DefaultSheet, R1: 0, C1: 0, R2: 2, C2: 2}},
+		{in: "Archive", want: Range{Sheet: "Archive", R2: -1, C2: -1}},
+		{in: "Мой лист", want: Range{Sheet: "Мой лист", R2: -1, C2: -1}},
+		// похоже на ячейку — ячейка листа по умолчанию, как в Sheets
+		{in: "Q1", want: Range{Sheet: DefaultSheet, R1: 0, C1: 16, R2: 0, C2: 16}},
+		{in: "'Мой лист'!B2", want: Range{Sheet: "Мой лист", R1: 1, C1: 1, R2: 1, C2: 1}},
+		{in: "'It''s'!A:C", want: Range{Sheet: "It's", R1: 0, C1: 0, R2: -1, C2: 2}},
+		{in: "'Sheet!1'!A1", want: Range{Sheet: "Sheet!1", R1: 0, C1: 0, R2: 0, C2: 0}},
+
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "Sheet!", wantErr: true},
+		{in: "!A1", wantErr: true},
+		{in: "''!A1", wantErr: true},
+		{in: "Items!A2:!", wantErr: true},
+		{in: "Bad'Name!A1", wantErr: true},
+		{in: "Sheet!A0", wantErr: true},
+		{in: "Sheet!AAAA1", wantErr: true},
+		{in: "Sheet!A1:", wantErr: true},
+		{in: "Sheet!A1-B2", wantErr: true},
+		{in: "Sheet!C1:A1", wantErr: true},
+		{in: "Sheet!A5:A2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %+v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "same range", a: "S!B2:E2", b: "S!B2:E2", want: true},
+		{name: "other sheet", a: "S!B2:E2", b: "T!B2:E2", want: false},
+		{name: "adjacent rows", a: "S!B2:E2", b: "S!B3:E3", want: false},
+		{name: "adjacent columns", a: "S!A1:B5", b: "S!C1:D5", want: false},
+		{name: "shared corner", a: "S!A1:B2", b: "S!B2:C3", want: true},
+		{name: "inside", a: "S!A1:Z100", b: "S!C3:D4", want: true},
+		{name: "open rows below", a: "Items!A2:O", b: "Items!C1000", want: true},
+		{name: "open rows, row above", a: "Items!A2:O", b: "Items!A1:O1", want: false},
+		{name: "open columns", a: "S!2:5", b: "S!ZZ3", want: true},
+		{name: "open columns, rows apart", a: "S!2:5", b: "S!A6:B7", want: false},
+		{name: "whole sheet", a: "Totals", b: "Totals!X99", want: true},
+		{name: "both open", a: "S!A:B", b: "S!B5:B", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Parse(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Parse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Overlaps(b); got != tt.want {
+				t.Errorf("%s overlaps %s = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := b.Overlaps(a); got != tt.want {
+				t.Errorf("%s overlaps %s = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
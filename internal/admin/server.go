@@ -0,0 +1,317 @@
+// Package admin — HTTP API для ручного запуска выгрузок и просмотра их результатов.
+// Все эндпоинты требуют заголовок Authorization: Bearer <Admin.Token>
+package admin
+
+import (
+	"avitoproject/internal/jobs"
+	"avitoproject/internal/metrics"
+	"avitoproject/internal/worker"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type Server struct {
+	logger  *zap.Logger
+	token   string
+	worker  *worker.Worker
+	service *metrics.ServiceMetrics
+	repo    *metrics.RepositoryMetrics
+	runner  *jobs.Runner
+	sched   Scheduler
+
+	ctx context.Context // контекст фоновых запусков, живёт дольше запроса
+
+	mu       sync.Mutex
+	stopping bool           // после Wait новые запуски не принимаются
+	runs     sync.WaitGroup // начатые через API запуски, их ждёт Wait
+}
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// Scheduler — задания планировщика. Ручные запуски идут через jobs.Runner с теми же ключами,
+// что и плановые, поэтому не накладываются на них
+type Scheduler interface {
+	Jobs(name string) []jobs.Job
+	Key(name, shopName string) (string, bool)
+}
+
+func NewServer(logger *zap.Logger, token string, runner *jobs.Runner, sched Scheduler, w *worker.Worker, service *metrics.ServiceMetrics, repo *metrics.RepositoryMetrics) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("admin token is not configured")
+	}
+	return &Server{
+		logger:  logger,
+		token:   token,
+		worker:  w,
+		service: service,
+		repo:    repo,
+		runner:  runner,
+		sched:   sched,
+		ctx:     context.Background(),
+	}, nil
+}
+
+// Handler возвращает роутер API:
+//
+//	POST   /api/run                 — запуск итогов всех магазинов в фоне, 409 — уже идёт
+//	POST   /api/shops/{shop}/run    — синхронный запуск одного магазина, ?job=totals|items, 409 — уже идёт
+//	GET    /api/snapshots           — состояние слотов снапшотов за сегодня: taken, pending, missed
+//	POST   /api/snapshots           — сохранить снапшоты сейчас, ?shop= и ?slot= сужают выбор, 409 — уже идёт
+//	DELETE /api/snapshots           — заархивировать и очистить все диапазоны снапшотов
+//	GET    /api/runs                — последние запуски по магазинам
+//	GET    /api/runs/{shop}         — последние запуски магазина
+//	GET    /api/jobs                — история запусков задач, ?job=, ?shop= и ?limit= (по умолчанию 50)
+//	GET    /api/tokens              — когда истекают закэшированные токены Avito по магазинам
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/run", s.handleRunAll)
+	mux.HandleFunc("POST /api/shops/{shop}/run", s.handleRunShop)
+	mux.HandleFunc("GET /api/snapshots", s.handleSnapshotSlots)
+	mux.HandleFunc("POST /api/snapshots", s.handleSaveSnapshots)
+	mux.HandleFunc("DELETE /api/snapshots", s.handleClearSnapshots)
+	mux.HandleFunc("GET /api/runs", s.handleRuns)
+	mux.HandleFunc("GET /api/runs/{shop}", s.handleShopRuns)
+	mux.HandleFunc("GET /api/jobs", s.handleJobs)
+	mux.HandleFunc("GET /api/tokens", s.handleTokens)
+	return s.authorize(mux)
+}
+
+// Serve поднимает API на addr и останавливает сервер при отмене ctx
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	s.ctx = ctx
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	s.logger.Info("Admin API started", zap.String("addr", addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Wait ждёт фоновые запуски, начатые через API, но не дольше ctx.
+// HTTP-сервер останавливается сам при отмене контекста Serve
+func (s *Server) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Admin API runs finished")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("admin API: runs still in progress: %w", ctx.Err())
+	}
+}
+
+// track учитывает новый запуск в s.runs. false — сервер останавливается, запускать нельзя
+func (s *Server) track() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.runs.Add(1)
+	return true
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRunAll(w http.ResponseWriter, r *http.Request) {
+	all := s.sched.Jobs(worker.JobTotals)
+	for _, job := range all {
+		if s.runner.Running(job.Key) {
+			writeError(w, http.StatusConflict, fmt.Errorf("run %s is already in progress", job.Key))
+			return
+		}
+	}
+
+	s.logger.Info("Manual run of all shops requested")
+	for _, job := range all {
+		if !s.track() {
+			writeError(w, http.StatusServiceUnavailable, errShuttingDown)
+			return
+		}
+		go func() {
+			defer s.runs.Done()
+			s.runner.Run(s.ctx, job, jobs.TriggerManual)
+		}()
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+func (s *Server) handleRunShop(w http.ResponseWriter, r *http.Request) {
+	shop := r.PathValue("shop")
+	job := r.URL.Query().Get("job")
+	if job == "" {
+		job = worker.JobTotals
+	}
+	if job != worker.JobTotals && job != worker.JobItems {
+		writeError(w, http.StatusBadRequest, errors.New("job must be totals or items"))
+		return
+	}
+	key, ok := s.sched.Key(job, shop)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("shop %q has no %s job", shop, job))
+		return
+	}
+	if !s.track() {
+		writeError(w, http.StatusServiceUnavailable, errShuttingDown)
+		return
+	}
+	defer s.runs.Done()
+
+	s.logger.Info("Manual shop run requested", zap.String("shop", shop), zap.String("job", job))
+	var result worker.RunResult
+	run := s.runner.Run(r.Context(), jobs.Job{
+		Name: job,
+		Key:  key,
+		Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+			res, err := s.worker.RunShop(ctx, shop, job)
+			if err != nil {
+				return nil, err
+			}
+			result = res
+			return worker.Outcomes([]worker.RunResult{res}), nil
+		},
+	}, jobs.TriggerManual)
+
+	switch {
+	case run.Outcome == jobs.OutcomeSkipped:
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is already in progress", key))
+	case result.Shop == "":
+		writeError(w, http.StatusInternalServerError, errors.New(run.Error))
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleSnapshotSlots — какие слоты снапшотов сегодня сняты, ждут или пропущены
+func (s *Server) handleSnapshotSlots(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.service.SnapshotSlots())
+}
+
+// handleSaveSnapshots снимает снапшоты под ключом плановой задачи snapshots: пока идёт плановый
+// запуск, ручной получает 409, а не пишет те же слоты параллельно
+func (s *Server) handleSaveSnapshots(w http.ResponseWriter, r *http.Request) {
+	shop, slot := r.URL.Query().Get("shop"), r.URL.Query().Get("slot")
+	if !s.track() {
+		writeError(w, http.StatusServiceUnavailable, errShuttingDown)
+		return
+	}
+	defer s.runs.Done()
+
+	s.logger.Info("Manual snapshot requested", zap.String("shop", shop), zap.String("slot", slot))
+	var (
+		saved   int
+		saveErr error
+	)
+	run := s.runner.Run(r.Context(), jobs.Job{
+		Name: metrics.JobSnapshots,
+		Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+			saved, saveErr = s.service.SaveSnapshotsNow(ctx, shop, slot)
+			return nil, saveErr
+		},
+	}, jobs.TriggerManual)
+
+	switch {
+	case run.Outcome == jobs.OutcomeSkipped:
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is already in progress", metrics.JobSnapshots))
+	case run.Outcome == jobs.OutcomePanic:
+		writeError(w, http.StatusInternalServerError, errors.New(run.Error))
+	case saveErr != nil:
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{"saved": saved, "error": saveErr.Error()})
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"saved": saved})
+	}
+}
+
+func (s *Server) handleClearSnapshots(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("Manual snapshot cleanup requested")
+	if s.repo == nil {
+		writeError(w, http.StatusConflict, errors.New("sheets sink is not enabled, there are no snapshot ranges"))
+		return
+	}
+	if err := s.repo.ClearAllSnapshotRanges(r.Context()); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+}
+
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.worker.LastRuns())
+}
+
+func (s *Server) handleShopRuns(w http.ResponseWriter, r *http.Request) {
+	runs, ok := s.worker.LastRuns()[r.PathValue("shop")]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("no runs for shop"))
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a non-negative integer"))
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, s.runner.History(q.Get("job"), q.Get("shop"), limit))
+}
+
+// handleTokens — магазин -> время истечения токена. Магазинов без токена в ответе нет
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.worker.TokenExpiries())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"avitoproject/internal/jobs"
+	"avitoproject/internal/metrics"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeScheduler — один магазин main в одной группе totals
+type fakeScheduler struct{}
+
+func (fakeScheduler) Jobs(name string) []jobs.Job {
+	return []jobs.Job{{Name: name, Key: name + ":main", Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) { return nil, nil }}}
+}
+
+func (fakeScheduler) Key(name, shopName string) (string, bool) {
+	return name + ":main", shopName == "main"
+}
+
+func TestManualRunConflictsWithScheduledRun(t *testing.T) {
+	runner := jobs.NewRunner(zap.NewNop(), 0, nil)
+	srv, err := NewServer(zap.NewNop(), "secret", runner, fakeScheduler{}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := srv.Handler()
+
+	// идут плановые запуски итогов магазина и снапшотов
+	release := make(chan struct{})
+	var scheduled sync.WaitGroup
+	for _, key := range []string{"totals:main", metrics.JobSnapshots} {
+		scheduled.Add(1)
+		go func() {
+			defer scheduled.Done()
+			runner.Run(context.Background(), jobs.Job{Name: key, Key: key, Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+				<-release
+				return nil, nil
+			}}, jobs.TriggerSchedule)
+		}()
+		for deadline := time.Now().Add(5 * time.Second); !runner.Running(key); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("scheduled run %s did not start", key)
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "run all", path: "/api/run", want: http.StatusConflict},
+		{name: "run shop", path: "/api/shops/main/run", want: http.StatusConflict},
+		{name: "unknown shop", path: "/api/shops/other/run", want: http.StatusNotFound},
+		{name: "save snapshots", path: "/api/snapshots?shop=main", want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	close(release)
+	scheduled.Wait()
+	if err := srv.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// после Wait ручные запуски не принимаются
+	req := httptest.NewRequest(http.MethodPost, "/api/snapshots", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("snapshots after Wait: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,473 @@
+// Package avitofake — фейковый Avito API в памяти процесса.
+// Поддерживает эндпоинты токена, объявлений, статистики и ставок,
+// которые использует avito.AvitoClient. Подходит для тестов и стейджинга.
+package avitofake
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+)
+
+const defaultTokenTTL = 24 * time.Hour
+
+type Item struct {
+	ID          int64
+	Title       string
+	URL         string
+	Impressions int
+	Views       int
+	Contacts    int
+	Spending    int
+	BidPenny    int
+}
+
+type Account struct {
+	UserId       int
+	ClientId     string
+	ClientSecret string
+	Items        []Item
+}
+
+type Server struct {
+	mu       sync.Mutex
+	accounts map[string]*Account // ключ = client_id
+	tokens   map[string]issuedToken
+	tokenTTL time.Duration
+	issued   int                  // сколько токенов выдано
+	failures map[string][]Failure // путь -> очередь ответов-ошибок
+	requests map[string]int       // путь -> сколько запросов пришло, включая ошибочные
+	closed   chan struct{}        // закрывается в Close, отпускает зависшие ответы
+	clock    clock.Clock          // по нему истекают токены
+	dates    []string             // даты dateFrom запросов статистики, по порядку
+
+	mux  *http.ServeMux
+	test *httptest.Server
+}
+
+func NewServer() *Server {
+	s := &Server{
+		accounts: make(map[string]*Account),
+		tokens:   make(map[string]issuedToken),
+		tokenTTL: defaultTokenTTL,
+		failures: make(map[string][]Failure),
+		requests: make(map[string]int),
+		closed:   make(chan struct{}),
+		clock:    clock.System,
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /token", s.handleToken)
+	s.mux.HandleFunc("GET /core/v1/items", s.handleItems)
+	s.mux.HandleFunc("POST /stats/v2/accounts/{userId}/items", s.handleStats)
+	s.mux.HandleFunc("POST /cpxpromo/1/getPromotionsByItemIds", s.handlePromotions)
+
+	return s
+}
+
+// Start поднимает локальный HTTP-сервер и возвращает его базовый URL
+func (s *Server) Start() string {
+	s.test = httptest.NewServer(s)
+	return s.test.URL
+}
+
+func (s *Server) Close() {
+	close(s.closed)
+	if s.test != nil {
+		s.test.Close()
+	}
+}
+
+// Failure — ответ с ошибкой, который сервер вернёт вместо обычного
+type Failure struct {
+	Status int
+	Header http.Header
+	Body   string
+	Hang   bool // не отвечать, пока клиент не оборвёт запрос
+}
+
+// FailNext ставит ошибочные ответы в очередь для пути, например "/token"
+// или "/stats/v2/accounts/1/items". Каждый следующий запрос забирает по одному
+func (s *Server) FailNext(path string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], failures...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	s.mu.Unlock()
+
+	if f, ok := s.nextFailure(r.URL.Path); ok {
+		if f.Hang {
+			// обрыв соединения сервер замечает, только дочитав тело запроса
+			io.Copy(io.Discard, r.Body)
+			select {
+			case <-r.Context().Done():
+			case <-s.closed:
+			}
+			return
+		}
+		for k, v := range f.Header {
+			w.Header()[k] = v
+		}
+		http.Error(w, f.Body, f.Status)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) nextFailure(path string) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.failures[path]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[path] = queue[1:]
+	return queue[0], true
+}
+
+type issuedToken struct {
+	clientId  string
+	expiresAt time.Time
+}
+
+// Requests — сколько запросов пришло на путь, включая ответы из FailNext
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// SetClock задаёт часы, по которым истекают токены, например clock.Fake
+func (s *Server) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock.Or(c)
+}
+
+// TokensIssued — сколько токенов выдал сервер
+func (s *Server) TokensIssued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// StatsDates — dateFrom всех запросов статистики по порядку
+func (s *Server) StatsDates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dates...)
+}
+
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTTL = ttl
+}
+
+func (s *Server) AddAccount(acc Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := acc
+	s.accounts[acc.ClientId] = &a
+}
+
+// SetItems заменяет объявления аккаунта, например чтобы сымитировать рост счётчиков
+func (s *Server) SetItems(clientId string, items []Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acc, ok := s.accounts[clientId]; ok {
+		acc.Items = items
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.accounts[r.PostForm.Get("client_id")]
+	if !ok || r.PostForm.Get("grant_type") != "client_credentials" || acc.ClientSecret != r.PostForm.Get("client_secret") {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	token := newToken()
+	s.tokens[token] = issuedToken{clientId: acc.ClientId, expiresAt: s.clock.Now().Add(s.tokenTTL)}
+	s.issued++
+
+	writeJSON(w, avito.AvitoTokenResponse{
+		AccessToken: token,
+		ExpiresIn:   int(s.tokenTTL.Seconds()),
+		TokenType:   "Bearer",
+	})
+}
+
+func (s *Server) handleItems(w http.ResponseWriter, r *http.Request) {
+	acc, ok := s.authorize(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page := queryInt(r, "page", 1)
+	perPage := queryInt(r, "per_page", 25)
+
+	type resource struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	res := struct {
+		Meta struct {
+			Page    int `json:"page"`
+			PerPage int `json:"per_page"`
+		} `json:"meta"`
+		Resources []resource `json:"resources"`
+	}{Resources: []resource{}}
+	res.Meta.Page = page
+	res.Meta.PerPage = perPage
+
+	s.mu.Lock()
+	for _, it := range window(acc.Items, (page-1)*perPage, perPage) {
+		res.Resources = append(res.Resources, resource{ID: it.ID, Title: it.Title, URL: it.URL})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, res)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	acc, ok := s.authorize(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if strconv.Itoa(acc.UserId) != r.PathValue("userId") {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req avito.AvitoMetricsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dates = append(s.dates, req.DateFrom)
+
+	var result avito.AvitoMetricsResult
+	switch req.Grouping {
+	case "totals":
+		result.DataTotalCount = 1
+		result.Groupings = []avito.AvitoGrouping{grouping(total(acc.Items), "totals", req.Metrics)}
+	case avito.GroupingDay, avito.GroupingWeek, avito.GroupingMonth:
+		// у фейка нет истории: каждый день периода равен текущим счётчикам
+		periods, err := periodGroupings(acc.Items, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result.DataTotalCount = len(periods)
+		result.Groupings = window(periods, req.Offset, req.Limit)
+	case "item":
+		result.DataTotalCount = len(acc.Items)
+		result.Groupings = []avito.AvitoGrouping{}
+		for _, it := range window(acc.Items, req.Offset, req.Limit) {
+			result.Groupings = append(result.Groupings, grouping(it, "item", req.Metrics))
+		}
+	default:
+		http.Error(w, "unsupported grouping", http.StatusBadRequest)
+		return
+	}
+	result.Timestamp = s.clock.Now().Format(time.RFC3339)
+
+	writeJSON(w, avito.AvitoMetricsResponse{Result: result})
+}
+
+func (s *Server) handlePromotions(w http.ResponseWriter, r *http.Request) {
+	acc, ok := s.authorize(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ItemIDs []int64 `json:"itemIDs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type promotion struct {
+		ItemID          int64 `json:"itemID"`
+		ManualPromotion struct {
+			BidPenny int `json:"bidPenny"`
+		} `json:"manualPromotion"`
+	}
+	res := struct {
+		Items []promotion `json:"items"`
+	}{Items: []promotion{}}
+
+	s.mu.Lock()
+	bids := make(map[int64]int, len(acc.Items))
+	for _, it := range acc.Items {
+		bids[it.ID] = it.BidPenny
+	}
+	s.mu.Unlock()
+
+	for _, id := range req.ItemIDs {
+		bid, ok := bids[id]
+		if !ok {
+			continue
+		}
+		p := promotion{ItemID: id}
+		p.ManualPromotion.BidPenny = bid
+		res.Items = append(res.Items, p)
+	}
+
+	writeJSON(w, res)
+}
+
+func (s *Server) authorize(r *http.Request) (*Account, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.tokens[token]
+	if !ok || !s.clock.Now().Before(issued.expiresAt) {
+		return nil, false
+	}
+	acc, ok := s.accounts[issued.clientId]
+	return acc, ok
+}
+
+func total(items []Item) Item {
+	var t Item
+	for _, it := range items {
+		t.Impressions += it.Impressions
+		t.Views += it.Views
+		t.Contacts += it.Contacts
+		t.Spending += it.Spending
+	}
+	return t
+}
+
+func periodGroupings(items []Item, req avito.AvitoMetricsRequest) ([]avito.AvitoGrouping, error) {
+	from, err := time.Parse("2006-01-02", req.DateFrom)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse("2006-01-02", req.DateTo)
+	if err != nil {
+		return nil, err
+	}
+
+	day := total(items)
+	var periods []avito.AvitoGrouping
+	var current Item
+	var start string
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d
+		switch req.Grouping {
+		case avito.GroupingWeek:
+			key = d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+		case avito.GroupingMonth:
+			key = time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+
+		if k := key.Format("2006-01-02"); k != start {
+			if start != "" {
+				periods = append(periods, periodGrouping(current, start, req))
+			}
+			start, current = k, Item{}
+		}
+		current.Impressions += day.Impressions
+		current.Views += day.Views
+		current.Contacts += day.Contacts
+		current.Spending += day.Spending
+	}
+	if start != "" {
+		periods = append(periods, periodGrouping(current, start, req))
+	}
+	return periods, nil
+}
+
+func periodGrouping(it Item, date string, req avito.AvitoMetricsRequest) avito.AvitoGrouping {
+	g := grouping(it, req.Grouping, req.Metrics)
+	g.ID = 0
+	g.Date = date
+	return g
+}
+
+func grouping(it Item, groupingType string, slugs []string) avito.AvitoGrouping {
+	values := map[string]int{
+		"impressions": it.Impressions,
+		"views":       it.Views,
+		"contacts":    it.Contacts,
+		"spending":    it.Spending,
+	}
+	if it.Impressions > 0 {
+		values["impressionsToViewsConversion"] = it.Views * 100 / it.Impressions
+	}
+	if it.Views > 0 {
+		values["viewsToContactsConversion"] = it.Contacts * 100 / it.Views
+	}
+
+	g := avito.AvitoGrouping{ID: int(it.ID), Type: groupingType, Metrics: []avito.AvitoMetric{}}
+	for _, slug := range slugs {
+		g.Metrics = append(g.Metrics, avito.AvitoMetric{Slug: slug, Value: values[slug]})
+	}
+	return g
+}
+
+func window[T any](items []T, offset, limit int) []T {
+	if offset < 0 || offset >= len(items) || limit <= 0 {
+		return nil
+	}
+	end := min(offset+limit, len(items))
+	return items[offset:end]
+}
+
+func queryInt(r *http.Request, key string, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
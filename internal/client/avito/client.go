@@ -1,135 +1,287 @@
 package avito
 
 import (
+	"avitoproject/internal/clock"
+	"avitoproject/internal/monitoring"
+	"avitoproject/internal/ratelimit"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
-type tokenCache struct {
-	Token     string
-	ExpiresAt time.Time
-}
+const (
+	itemsPerPage   = 100
+	bidsBatchSize  = 200
+	statsPageLimit = 1000
+	statsMaxPages  = 50 // защита от бесконечной пагинации: не больше 50 000 строк статистики
+
+	tokenRefreshMargin = 5 * time.Minute
+)
 
 type AvitoClient struct {
-	logger     *zap.Logger
-	TokenUrl   string
-	MetricsUrl string
+	logger    *zap.Logger
+	http      *http.Client
+	endpoints endpoints
+	retry     RetryPolicy
+	limits    *ratelimit.Group // ключ = client_id магазина
+	timeout   time.Duration    // на одну попытку запроса
+	clock     clock.Clock
+
+	tokens TokenStore // ключ = client_id магазина
+
+	refreshMu sync.Mutex
+	refreshes map[string]*tokenRefresh // текущие обновления токена по client_id
+}
+
+type Options struct {
+	HTTPClient *http.Client // nil — http.DefaultClient
+	BaseUrl    string       // пустое значение — DefaultBaseUrl
+	Tokens     TokenStore   // nil — токены хранятся в памяти
+	Retry      RetryPolicy  // незаполненные поля — из DefaultRetryPolicy
+	Limits     *ratelimit.Group
+	Timeout    time.Duration // на одну попытку запроса, 0 — DefaultTimeout
+	Clock      clock.Clock   // истечение токенов, даты запросов статистики и паузы между повторами. nil — clock.System
+}
+
+const DefaultTimeout = 30 * time.Second
 
-	tokens map[string]tokenCache // ключ = client_id магазина
+// Один запрос за токеном на client_id, остальные ждут его результат
+type tokenRefresh struct {
+	done  chan struct{}
+	token Token
+	err   error
 }
 
-func NewAvitoClient(logger *zap.Logger, TokenUrl, MetricsUrl string) *AvitoClient {
+func NewAvitoClient(logger *zap.Logger, opts Options) *AvitoClient {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Tokens == nil {
+		opts.Tokens = NewMemoryTokenStore()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
 	return &AvitoClient{
-		logger:     logger,
-		TokenUrl:   TokenUrl,
-		MetricsUrl: MetricsUrl,
-		tokens:     make(map[string]tokenCache),
+		logger:    logger,
+		http:      opts.HTTPClient,
+		endpoints: newEndpoints(opts.BaseUrl),
+		retry:     opts.Retry.withDefaults(),
+		limits:    opts.Limits,
+		timeout:   opts.Timeout,
+		clock:     clock.Or(opts.Clock),
+		tokens:    opts.Tokens,
+		refreshes: make(map[string]*tokenRefresh),
 	}
 }
 
 // Получение нового токена для конкретного магазина
-func (a *AvitoClient) getToken(cId, cSec string) error {
+func (a *AvitoClient) getToken(ctx context.Context, acc Account, budget *Budget) (Token, error) {
 	form := url.Values{}
 	form.Add("grant_type", "client_credentials")
-	form.Add("client_id", cId)
-	form.Add("client_secret", cSec)
-
-	req, err := http.NewRequest("POST", a.TokenUrl, bytes.NewBufferString(form.Encode()))
-	if err != nil {
-		return err
-	}
+	form.Add("client_id", acc.ClientId)
+	form.Add("client_secret", acc.ClientSecret)
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.send(ctx, acc, budget, "token", func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", a.endpoints.token(), bytes.NewBufferString(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+		return Token{}, err
 	}
 
 	var tr AvitoTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
-		return err
+	if err := json.Unmarshal(resp.body, &tr); err != nil {
+		return Token{}, decodeError(acc, "token", resp, err)
 	}
-
-	// сохраняем токен *отдельно* для каждого client_id
-	a.tokens[cId] = tokenCache{
-		Token:     tr.AccessToken,
-		ExpiresAt: time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	if tr.AccessToken == "" {
+		return Token{}, decodeError(acc, "token", resp, fmt.Errorf("empty access_token"))
 	}
 
-	return nil
+	return Token{
+		Token:     tr.AccessToken,
+		ExpiresAt: a.clock.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}, nil
 }
 
 // Возвращает токен для магазина, обновляет если просрочен
-func (a *AvitoClient) Token(cId, cSec string) (string, error) {
-	tc, ok := a.tokens[cId]
+func (a *AvitoClient) Token(ctx context.Context, cId, cSec string) (string, error) {
+	acc := Account{ClientId: cId, ClientSecret: cSec}
+	return a.token(ctx, acc, a.budgetFor(acc))
+}
+
+func (a *AvitoClient) token(ctx context.Context, acc Account, budget *Budget) (string, error) {
+	tc, ok := a.tokens.Get(acc.ClientId)
 
-	// если нет токена или скоро протухнет — получаем новыйу
-	if !ok || tc.Token == "" || time.Now().After(tc.ExpiresAt.Add(-5*time.Minute)) {
-		if err := a.getToken(cId, cSec); err != nil {
-			a.logger.Error("failed to refresh token", zap.Error(err))
+	// если нет токена или скоро протухнет — получаем новый
+	if !ok || tc.Token == "" || a.clock.Now().After(tc.ExpiresAt.Add(-tokenRefreshMargin)) {
+		var err error
+		if tc, err = a.refreshToken(ctx, acc, budget); err != nil {
+			a.logger.Error("failed to refresh token", zap.String("shop", acc.Name), zap.Error(err))
 			return "", err
 		}
-
-		tc = a.tokens[cId]
 	}
 
 	return tc.Token, nil
 }
 
-func (a *AvitoClient) GetAvitoMetrics(uId int, cId, cSec string) (AvitoMetricsData, error) {
-	token, err := a.Token(cId, cSec)
-	if err != nil {
-		return AvitoMetricsData{}, err
+// TokenExpiry — время истечения закэшированного токена client_id, для диагностики
+func (a *AvitoClient) TokenExpiry(cId string) (time.Time, bool) {
+	tc, ok := a.tokens.Get(cId)
+	if !ok || tc.Token == "" {
+		return time.Time{}, false
 	}
+	return tc.ExpiresAt, true
+}
 
-	metricsUrl := fmt.Sprintf("%s%d/items", a.MetricsUrl, uId)
+func (a *AvitoClient) refreshToken(ctx context.Context, acc Account, budget *Budget) (Token, error) {
+	cId := acc.ClientId
+
+	a.refreshMu.Lock()
+	if r, ok := a.refreshes[cId]; ok {
+		a.refreshMu.Unlock()
+		select {
+		case <-r.done:
+			return r.token, r.err
+		case <-ctx.Done():
+			return Token{}, ctx.Err()
+		}
+	}
+	r := &tokenRefresh{done: make(chan struct{})}
+	a.refreshes[cId] = r
+	a.refreshMu.Unlock()
+
+	r.token, r.err = a.getToken(ctx, acc, budget)
+	monitoring.TokenRefresh(r.err)
+	if r.err == nil {
+		if err := a.tokens.Set(cId, r.token); err != nil {
+			// токен рабочий, просто не переживёт рестарт
+			a.logger.Warn("failed to persist token", zap.String("clientId", cId), zap.Error(err))
+		}
+		a.logger.Info("token refreshed", zap.String("clientId", cId), zap.Time("expiresAt", r.token.ExpiresAt))
+	}
 
-	reqBody := AvitoMetricsRequest{
-		DateFrom: time.Now().Format("2006-01-02"),
-		DateTo:   time.Now().Format("2006-01-02"),
-		Grouping: "totals",
-		Limit:    1000,
-		Offset:   0,
-		Metrics:  []string{"views", "contacts", "impressions", "spending", "clickPackages", "impressionsToViewsConversion", "viewsToContactsConversion"},
+	a.refreshMu.Lock()
+	delete(a.refreshes, cId)
+	a.refreshMu.Unlock()
+	close(r.done)
+
+	return r.token, r.err
+}
+
+// call — запрос с токеном магазина. На 401 сбрасывает закэшированный токен и повторяет запрос один раз
+func (a *AvitoClient) call(ctx context.Context, acc Account, budget *Budget, endpoint, method, u string, payload interface{}, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
 	}
 
-	body, _ := json.Marshal(reqBody)
+	for reauth := false; ; reauth = true {
+		token, err := a.token(ctx, acc, budget)
+		if err != nil {
+			return err
+		}
 
-	req, _ := http.NewRequest("POST", metricsUrl, bytes.NewBuffer(body))
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+		resp, err := a.send(ctx, acc, budget, endpoint, func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			if payload != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			return req, nil
+		})
+		if resp != nil && resp.status == http.StatusUnauthorized && !reauth {
+			a.logger.Warn("token rejected, refreshing", zap.String("shop", acc.Name), zap.String("endpoint", endpoint))
+			if err := a.tokens.Delete(acc.ClientId); err != nil {
+				a.logger.Warn("failed to drop token", zap.String("clientId", acc.ClientId), zap.Error(err))
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		a.logger.Error(err.Error())
-		return AvitoMetricsData{}, err
+		if err := json.Unmarshal(resp.body, out); err != nil {
+			return decodeError(acc, endpoint, resp, err)
+		}
+		return nil
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		a.logger.Error(fmt.Sprintf("bad status: %s", resp.Status))
-		return AvitoMetricsData{}, fmt.Errorf("bad status: %s", resp.Status)
+// fetchStats проходит по всем страницам статистики, пока не наберёт dataTotalCount строк
+func (a *AvitoClient) fetchStats(ctx context.Context, acc Account, budget *Budget, reqBody AvitoMetricsRequest) ([]AvitoGrouping, error) {
+	var groupings []AvitoGrouping
+	total := 0
+
+	for page := 0; page < statsMaxPages; page++ {
+		reqBody.Offset = page * reqBody.Limit
+
+		var data AvitoMetricsResponse
+		if err := a.call(ctx, acc, budget, "stats", "POST", a.endpoints.stats(acc.UserId), reqBody, &data); err != nil {
+			return nil, err
+		}
+
+		groupings = append(groupings, data.Result.Groupings...)
+		total = data.Result.DataTotalCount
+
+		if len(groupings) >= total {
+			return groupings, nil
+		}
+		if len(data.Result.Groupings) == 0 {
+			a.logger.Warn("stats page is empty before dataTotalCount reached",
+				zap.String("shop", acc.Name),
+				zap.Int("fetched", len(groupings)),
+				zap.Int("dataTotalCount", total),
+			)
+			return groupings, nil
+		}
 	}
 
-	var data AvitoMetricsResponse
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		a.logger.Error(err.Error())
+	a.logger.Warn("stats result truncated",
+		zap.String("shop", acc.Name),
+		zap.String("grouping", reqBody.Grouping),
+		zap.Int("fetched", len(groupings)),
+		zap.Int("dataTotalCount", total),
+	)
+	return groupings, nil
+}
+
+func (a *AvitoClient) GetAvitoMetrics(ctx context.Context, acc Account) (AvitoMetricsData, error) {
+	budget := a.budgetFor(acc)
+
+	reqBody := AvitoMetricsRequest{
+		DateFrom: clock.Day(a.clock.Now(), acc.Location),
+		DateTo:   clock.Day(a.clock.Now(), acc.Location),
+		Grouping: "totals",
+		Limit:    statsPageLimit,
+		Offset:   0,
+		Metrics:  []string{"views", "contacts", "impressions", "spending", "clickPackages", "impressionsToViewsConversion", "viewsToContactsConversion"},
+	}
+
+	groupings, err := a.fetchStats(ctx, acc, budget, reqBody)
+	if err != nil {
+		a.logger.Error("failed to get metrics", zap.String("shop", acc.Name), zap.Error(err))
 		return AvitoMetricsData{}, err
 	}
 
 	metricsMap := make(map[string]int)
-	for _, grouping := range data.Result.Groupings {
+	for _, grouping := range groupings {
 		for _, metric := range grouping.Metrics {
 			metricsMap[metric.Slug] = metric.Value
 		}
@@ -145,15 +297,10 @@ func (a *AvitoClient) GetAvitoMetrics(uId int, cId, cSec string) (AvitoMetricsDa
 	}, nil
 }
 
-func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *zap.Logger) ([]ItemMetrics, error) {
-	logger.Info("Start GetMetricsForAllItems", zap.Int("userId", uId))
+func (a *AvitoClient) GetMetricsForAllItems(ctx context.Context, acc Account, logger *zap.Logger) ([]ItemMetrics, error) {
+	logger.Info("Start GetMetricsForAllItems", zap.String("shop", acc.Name), zap.Int("userId", acc.UserId))
 
-	token, err := a.Token(cId, cSec)
-	if err != nil {
-		logger.Error("Failed to get token", zap.Error(err))
-		return nil, err
-	}
-	logger.Debug("Token retrieved", zap.String("token", token[:10]+"..."))
+	budget := a.budgetFor(acc)
 
 	// --- 1. Получение всех активных объявлений ---
 	items := []struct {
@@ -163,22 +310,6 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 	}{}
 	page := 1
 	for {
-		url := fmt.Sprintf("https://api.avito.ru/core/v1/items?status=active&per_page=100&page=%d", page)
-		req, _ := http.NewRequest("GET", url, nil)
-		req.Header.Set("Authorization", "Bearer "+token)
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			logger.Error("Failed to get items page", zap.Int("page", page), zap.Error(err))
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			logger.Error("Bad status when fetching items", zap.Int("page", page), zap.String("status", resp.Status))
-			return nil, fmt.Errorf("bad status: %s", resp.Status)
-		}
-
 		var res struct {
 			Meta struct {
 				Page    int `json:"page"`
@@ -190,15 +321,15 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 				URL   string `json:"url"`
 			} `json:"resources"`
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-			logger.Error("Failed to decode items response", zap.Int("page", page), zap.Error(err))
+		if err := a.call(ctx, acc, budget, "items", "GET", a.endpoints.items(page), nil, &res); err != nil {
+			logger.Error("Failed to get items page", zap.Int("page", page), zap.Error(err))
 			return nil, err
 		}
 
 		logger.Info("Items page fetched", zap.Int("page", page), zap.Int("count", len(res.Resources)))
 
 		items = append(items, res.Resources...)
-		if len(res.Resources) < 100 {
+		if len(res.Resources) < itemsPerPage {
 			break
 		}
 		page++
@@ -211,44 +342,26 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 	}
 
 	// --- 2. Получаем метрики по объявлениям ---
-	metricsURL := fmt.Sprintf("%s%d/items", a.MetricsUrl, uId)
 	reqBody := AvitoMetricsRequest{
-		DateFrom: time.Now().Format("2006-01-02"),
-		DateTo:   time.Now().Format("2006-01-02"),
+		DateFrom: clock.Day(a.clock.Now(), acc.Location),
+		DateTo:   clock.Day(a.clock.Now(), acc.Location),
 		Grouping: "item",
-		Limit:    1000,
+		Limit:    statsPageLimit,
 		Offset:   0,
 		Metrics:  []string{"views", "contacts", "impressions", "spending"},
 	}
-	body, _ := json.Marshal(reqBody)
 
-	req, _ := http.NewRequest("POST", metricsURL, bytes.NewBuffer(body))
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
+	groupings, err := a.fetchStats(ctx, acc, budget, reqBody)
 	if err != nil {
 		logger.Error("Failed to get item metrics", zap.Error(err))
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		logger.Error("Bad status fetching metrics", zap.String("status", resp.Status))
-		return nil, fmt.Errorf("bad status: %s", resp.Status)
-	}
-
-	var metricsRes AvitoMetricsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&metricsRes); err != nil {
-		logger.Error("Failed to decode metrics response", zap.Error(err))
-		return nil, err
-	}
-	logger.Info("Item metrics fetched", zap.Int("metricsCount", len(metricsRes.Result.Groupings)))
+	logger.Info("Item metrics fetched", zap.Int("metricsCount", len(groupings)))
 
 	// --- 3. Получаем bidPenny батчами по 200 ---
 	idToBid := make(map[int64]int)
-	for i := 0; i < len(items); i += 200 {
-		end := i + 200
+	for i := 0; i < len(items); i += bidsBatchSize {
+		end := i + bidsBatchSize
 		if end > len(items) {
 			end = len(items)
 		}
@@ -257,23 +370,6 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 			batchIDs = append(batchIDs, it.ID)
 		}
 
-		batchBody, _ := json.Marshal(map[string][]int64{"itemIDs": batchIDs})
-		req, _ := http.NewRequest("POST", "https://api.avito.ru/cpxpromo/1/getPromotionsByItemIds", bytes.NewBuffer(batchBody))
-		req.Header.Set("Authorization", "Bearer "+token)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			logger.Error("Failed to get bid batch", zap.Int("batchStart", i), zap.Int("batchEnd", end), zap.Error(err))
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			logger.Error("Bad status fetching bid", zap.Int("batchStart", i), zap.Int("batchEnd", end), zap.String("status", resp.Status))
-			return nil, fmt.Errorf("bad status: %s", resp.Status)
-		}
-
 		var bidRes struct {
 			Items []struct {
 				ItemID          int64 `json:"itemID"`
@@ -282,8 +378,9 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 				} `json:"manualPromotion"`
 			} `json:"items"`
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&bidRes); err != nil {
-			logger.Error("Failed to decode bid response", zap.Int("batchStart", i), zap.Int("batchEnd", end), zap.Error(err))
+		batchBody := map[string][]int64{"itemIDs": batchIDs}
+		if err := a.call(ctx, acc, budget, "promotions", "POST", a.endpoints.promotions(), batchBody, &bidRes); err != nil {
+			logger.Error("Failed to get bid batch", zap.Int("batchStart", i), zap.Int("batchEnd", end), zap.Error(err))
 			return nil, err
 		}
 
@@ -300,7 +397,7 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 	for _, it := range items {
 		var mAvito AvitoGrouping
 		found := false
-		for _, g := range metricsRes.Result.Groupings {
+		for _, g := range groupings {
 			if int64(g.ID) == it.ID {
 				mAvito = g
 				found = true
@@ -325,15 +422,15 @@ func (a *AvitoClient) GetMetricsForAllItems(uId int, cId, cSec string, logger *z
 		}
 
 		itemMetrics = append(itemMetrics, ItemMetrics{
-			ID:                     it.ID,
-			Link:                   it.URL,
-			Title:                  it.Title,
-			Impressions:            metricsMap["impressions"],
-			Views:                  metricsMap["views"],
-			Contacts:               contacts,
-			Spending:               spending,
-			BidPenny:               idToBid[it.ID],
-			CostPerContactLastHour: cpc,
+			ID:                  it.ID,
+			Link:                it.URL,
+			Title:               it.Title,
+			Impressions:         metricsMap["impressions"],
+			Views:               metricsMap["views"],
+			Contacts:            contacts,
+			Spending:            spending,
+			BidPenny:            idToBid[it.ID],
+			CostPerContactToday: cpc,
 		})
 		logger.Debug("ItemMetrics prepared", zap.Int64("itemID", it.ID), zap.Any("metricsMap", metricsMap), zap.Int("bid", idToBid[it.ID]))
 	}
@@ -0,0 +1,109 @@
+package avito
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// statsServer отдаёт строки статистики страницами: всего rows строк, а в dataTotalCount пишет claimed
+func statsServer(t *testing.T, rows, claimed int) (*AvitoClient, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AvitoTokenResponse{AccessToken: "token", ExpiresIn: 3600})
+	})
+	mux.HandleFunc("POST /stats/v2/accounts/1/items", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req AvitoMetricsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res := AvitoMetricsResponse{}
+		res.Result.DataTotalCount = claimed
+		res.Result.Groupings = []AvitoGrouping{}
+		for i := req.Offset; i < min(req.Offset+req.Limit, rows); i++ {
+			res.Result.Groupings = append(res.Result.Groupings, AvitoGrouping{ID: i, Type: "item"})
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return NewAvitoClient(zap.NewNop(), Options{BaseUrl: srv.URL, Retry: RetryPolicy{MaxAttempts: 1}}), &requests
+}
+
+func TestFetchStatsPagination(t *testing.T) {
+	tests := []struct {
+		name         string
+		rows         int // строк на сервере
+		claimed      int // dataTotalCount в ответе
+		limit        int
+		wantRows     int
+		wantRequests int
+	}{
+		{name: "single page", rows: 3, claimed: 3, limit: 1000, wantRows: 3, wantRequests: 1},
+		{name: "exact pages", rows: 20, claimed: 20, limit: 10, wantRows: 20, wantRequests: 2},
+		{name: "partial last page", rows: 25, claimed: 25, limit: 10, wantRows: 25, wantRequests: 3},
+		{name: "no rows", rows: 0, claimed: 0, limit: 10, wantRows: 0, wantRequests: 1},
+		{name: "empty page before total", rows: 15, claimed: 40, limit: 10, wantRows: 15, wantRequests: 3},
+		{name: "cut off at statsMaxPages", rows: 1 << 20, claimed: 1 << 20, limit: 10, wantRows: statsMaxPages * 10, wantRequests: statsMaxPages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requests := statsServer(t, tt.rows, tt.claimed)
+			acc := Account{Name: "main", UserId: 1, ClientId: "client", ClientSecret: "secret"}
+
+			got, err := client.fetchStats(context.Background(), acc, client.NewBudget(acc), AvitoMetricsRequest{Grouping: "item", Limit: tt.limit})
+			if err != nil {
+				t.Fatalf("fetchStats: %v", err)
+			}
+			if len(got) != tt.wantRows {
+				t.Errorf("rows = %d, want %d", len(got), tt.wantRows)
+			}
+			if n := int(requests.Load()); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+			for i, g := range got {
+				if g.ID != i {
+					t.Fatalf("row %d has ID %d: pages are out of order or overlap", i, g.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchStatsStopsOnError(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AvitoTokenResponse{AccessToken: "token", ExpiresIn: 3600})
+	})
+	mux.HandleFunc("POST /stats/v2/accounts/1/items", func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"result":{"dataTotalCount":30,"groupings":[{"id":1},{"id":2},{"id":3},{"id":4},{"id":5},{"id":6},{"id":7},{"id":8},{"id":9},{"id":10}]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := NewAvitoClient(zap.NewNop(), Options{BaseUrl: srv.URL, Retry: RetryPolicy{MaxAttempts: 1}})
+	acc := Account{Name: "main", UserId: 1, ClientId: "client", ClientSecret: "secret"}
+	if _, err := client.fetchStats(context.Background(), acc, client.NewBudget(acc), AvitoMetricsRequest{Limit: 10}); err == nil {
+		t.Fatal("fetchStats succeeded, want the error of the second page")
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
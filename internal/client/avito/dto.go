@@ -8,3 +8,9 @@ type AvitoMetricsData struct {
 	ImpressionsToViewsConversion int
 	ViewsToContactsConversion    int
 }
+
+// Метрики магазина за один период исторической выгрузки
+type PeriodMetrics struct {
+	Period string // начало периода, YYYY-MM-DD
+	AvitoMetricsData
+}
@@ -0,0 +1,37 @@
+package avito
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultBaseUrl = "https://api.avito.ru"
+
+// Все адреса Avito API строятся от одного базового URL,
+// чтобы клиент можно было направить на локальный фейковый сервер
+type endpoints struct {
+	base string
+}
+
+func newEndpoints(baseUrl string) endpoints {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+	return endpoints{base: strings.TrimRight(baseUrl, "/")}
+}
+
+func (e endpoints) token() string {
+	return e.base + "/token"
+}
+
+func (e endpoints) stats(uId int) string {
+	return fmt.Sprintf("%s/stats/v2/accounts/%d/items", e.base, uId)
+}
+
+func (e endpoints) items(page int) string {
+	return fmt.Sprintf("%s/core/v1/items?status=active&per_page=%d&page=%d", e.base, itemsPerPage, page)
+}
+
+func (e endpoints) promotions() string {
+	return e.base + "/cpxpromo/1/getPromotionsByItemIds"
+}
@@ -0,0 +1,172 @@
+package avito
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const errorBodyExcerpt = 512
+
+// APIError — неуспешный ответ Avito API. Все типизированные ошибки ниже
+// разворачиваются в него, так что errors.As с *APIError срабатывает на любую из них
+type APIError struct {
+	Shop     string
+	Endpoint string
+	Status   int
+	Body     string // начало тела ответа
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("avito %s: bad status %d %s", e.Endpoint, e.Status, http.StatusText(e.Status))
+	if e.Shop != "" {
+		msg = fmt.Sprintf("shop %s: %s", e.Shop, msg)
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// AuthError — Avito не принимает client_id/client_secret или токен магазина
+type AuthError struct{ APIError }
+
+func (e *AuthError) Unwrap() error { return &e.APIError }
+
+// ForbiddenError — у приложения нет прав (scope) на эндпоинт или аккаунт
+type ForbiddenError struct{ APIError }
+
+func (e *ForbiddenError) Unwrap() error { return &e.APIError }
+
+// RateLimitError — лимит запросов исчерпан и повторы не помогли
+type RateLimitError struct {
+	APIError
+	RetryAfter time.Duration // подсказка Avito, 0 — если её не было
+}
+
+func (e *RateLimitError) Unwrap() error { return &e.APIError }
+
+// ServerError — 5xx, оставшиеся после всех повторов
+type ServerError struct{ APIError }
+
+func (e *ServerError) Unwrap() error { return &e.APIError }
+
+// UserNotFoundError — аккаунт с таким UserId не найден
+type UserNotFoundError struct {
+	APIError
+	UserId int
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("user %d not found: %s", e.UserId, e.APIError.Error())
+}
+
+func (e *UserNotFoundError) Unwrap() error { return &e.APIError }
+
+// DecodeError — ответ 200, но тело не соответствует ожидаемой схеме
+type DecodeError struct {
+	APIError
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("shop %s: decode avito %s response: %v", e.Shop, e.Endpoint, e.Err)
+}
+
+func (e *DecodeError) Unwrap() []error { return []error{&e.APIError, e.Err} }
+
+// ErrorKind — короткий код ошибки для логов и алертов
+func ErrorKind(err error) string {
+	var (
+		authErr      *AuthError
+		forbiddenErr *ForbiddenError
+		rateErr      *RateLimitError
+		serverErr    *ServerError
+		notFoundErr  *UserNotFoundError
+		decodeErr    *DecodeError
+		apiErr       *APIError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &authErr):
+		return "auth"
+	case errors.As(err, &forbiddenErr):
+		return "forbidden"
+	case errors.As(err, &rateErr):
+		return "rate_limit"
+	case errors.As(err, &serverErr):
+		return "server"
+	case errors.As(err, &notFoundErr):
+		return "user_not_found"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	case errors.As(err, &apiErr):
+		return "api"
+	default:
+		return "transport"
+	}
+}
+
+// IsPermanent — ошибка не пройдёт сама, нужен новый конфиг магазина: неверные ключи или UserId.
+// 403 сюда не входит: у приложения может не быть прав на один эндпоинт, см. IsForbidden
+func IsPermanent(err error) bool {
+	switch ErrorKind(err) {
+	case "auth", "user_not_found":
+		return true
+	}
+	return false
+}
+
+// IsForbidden — у приложения нет прав на эндпоинт, остальные эндпоинты магазина могут работать
+func IsForbidden(err error) bool {
+	return ErrorKind(err) == "forbidden"
+}
+
+func (a *AvitoClient) statusError(acc Account, endpoint string, resp *response) error {
+	base := APIError{
+		Shop:     acc.Name,
+		Endpoint: endpoint,
+		Status:   resp.status,
+		Body:     excerpt(resp.body),
+	}
+
+	switch {
+	case resp.status == http.StatusUnauthorized,
+		endpoint == "token" && (resp.status == http.StatusBadRequest || resp.status == http.StatusForbidden):
+		return &AuthError{base}
+	case resp.status == http.StatusForbidden:
+		return &ForbiddenError{base}
+	case resp.status == http.StatusNotFound && endpoint == "stats":
+		return &UserNotFoundError{APIError: base, UserId: acc.UserId}
+	case resp.status == http.StatusTooManyRequests:
+		hint, _ := retryHint(resp.header, a.clock.Now())
+		return &RateLimitError{APIError: base, RetryAfter: hint}
+	case resp.status >= http.StatusInternalServerError:
+		return &ServerError{base}
+	default:
+		return &base
+	}
+}
+
+func decodeError(acc Account, endpoint string, resp *response, err error) error {
+	return &DecodeError{
+		APIError: APIError{
+			Shop:     acc.Name,
+			Endpoint: endpoint,
+			Status:   resp.status,
+			Body:     excerpt(resp.body),
+		},
+		Err: err,
+	}
+}
+
+func excerpt(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > errorBodyExcerpt {
+		s = strings.ToValidUTF8(s[:errorBodyExcerpt], "") + "..."
+	}
+	return s
+}
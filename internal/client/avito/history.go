@@ -0,0 +1,116 @@
+package avito
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	GroupingDay   = "day"
+	GroupingWeek  = "week"
+	GroupingMonth = "month"
+
+	// максимальная длина периода в одном запросе статистики
+	historyChunkDays = 90
+	dateLayout       = "2006-01-02"
+)
+
+// GetMetricsHistory возвращает метрики магазина за [from, to] (даты включительно)
+// с группировкой по дням, неделям или месяцам. Диапазон режется на куски не длиннее
+// historyChunkDays так, чтобы один период группировки не попадал в два запроса
+func (a *AvitoClient) GetMetricsHistory(ctx context.Context, acc Account, from, to time.Time, grouping string) ([]PeriodMetrics, error) {
+	if grouping != GroupingDay && grouping != GroupingWeek && grouping != GroupingMonth {
+		return nil, fmt.Errorf("unsupported grouping %q", grouping)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("date range is empty: %s > %s", from.Format(dateLayout), to.Format(dateLayout))
+	}
+
+	budget := a.budgetFor(acc)
+	var result []PeriodMetrics
+
+	for _, chunk := range historyChunks(from, to, grouping) {
+		a.logger.Info("fetching metrics history",
+			zap.String("shop", acc.Name),
+			zap.String("grouping", grouping),
+			zap.String("from", chunk[0].Format(dateLayout)),
+			zap.String("to", chunk[1].Format(dateLayout)),
+		)
+
+		groupings, err := a.fetchStats(ctx, acc, budget, AvitoMetricsRequest{
+			DateFrom: chunk[0].Format(dateLayout),
+			DateTo:   chunk[1].Format(dateLayout),
+			Grouping: grouping,
+			Limit:    statsPageLimit,
+			Metrics:  []string{"views", "contacts", "impressions", "spending", "impressionsToViewsConversion", "viewsToContactsConversion"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range groupings {
+			m := make(map[string]int)
+			for _, metric := range g.Metrics {
+				m[metric.Slug] = metric.Value
+			}
+			result = append(result, PeriodMetrics{
+				Period: g.Date,
+				AvitoMetricsData: AvitoMetricsData{
+					Spending:                     m["spending"],
+					Impressions:                  m["impressions"],
+					Contacts:                     m["contacts"],
+					Views:                        m["views"],
+					ImpressionsToViewsConversion: m["impressionsToViewsConversion"],
+					ViewsToContactsConversion:    m["viewsToContactsConversion"],
+				},
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// historyChunks делит [from, to] на отрезки [начало, конец] по границам периодов группировки
+func historyChunks(from, to time.Time, grouping string) [][2]time.Time {
+	from = truncateDay(from)
+	to = truncateDay(to)
+
+	var chunks [][2]time.Time
+	chunkStart := from
+	for start := from; !start.After(to); {
+		end := periodEnd(start, grouping)
+		if end.After(to) {
+			end = to
+		}
+
+		// период не влезает в текущий кусок — закрываем кусок до начала периода.
+		// Считаем календарными днями: в сутках перехода на летнее время 23 часа
+		if start.After(chunkStart) && end.After(chunkStart.AddDate(0, 0, historyChunkDays-1)) {
+			chunks = append(chunks, [2]time.Time{chunkStart, start.AddDate(0, 0, -1)})
+			chunkStart = start
+		}
+
+		start = end.AddDate(0, 0, 1)
+	}
+	return append(chunks, [2]time.Time{chunkStart, to})
+}
+
+// periodEnd — последний день периода группировки, в который попадает day
+func periodEnd(day time.Time, grouping string) time.Time {
+	switch grouping {
+	case GroupingWeek:
+		// недели с понедельника по воскресенье
+		return day.AddDate(0, 0, (7-int(day.Weekday()))%7)
+	case GroupingMonth:
+		return time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,139 @@
+package avito
+
+import (
+	"testing"
+	"time"
+)
+
+// day разбирает "2006-01-02" или "2006-01-02 15:04" в UTC
+func day(s string) time.Time {
+	return dayIn(s, time.UTC)
+}
+
+func dayIn(s string, loc *time.Location) time.Time {
+	layout := dateLayout
+	if len(s) > len(dateLayout) {
+		layout = "2006-01-02 15:04"
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestHistoryChunks(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to string
+		grouping string
+		loc      *time.Location // nil — UTC
+		want     [][2]string
+	}{
+		{
+			name: "single day", from: "2026-03-10", to: "2026-03-10", grouping: GroupingDay,
+			want: [][2]string{{"2026-03-10", "2026-03-10"}},
+		},
+		{
+			name: "days within limit", from: "2026-01-01", to: "2026-03-31", grouping: GroupingDay,
+			want: [][2]string{{"2026-01-01", "2026-03-31"}},
+		},
+		{
+			name: "days split by 90", from: "2026-01-01", to: "2026-07-19", grouping: GroupingDay,
+			want: [][2]string{{"2026-01-01", "2026-03-31"}, {"2026-04-01", "2026-06-29"}, {"2026-06-30", "2026-07-19"}},
+		},
+		{
+			// 2026-01-01 — четверг: первая неделя неполная, куски режутся по понедельникам
+			name: "weeks aligned to monday", from: "2026-01-01", to: "2026-05-31", grouping: GroupingWeek,
+			want: [][2]string{{"2026-01-01", "2026-03-29"}, {"2026-03-30", "2026-05-31"}},
+		},
+		{
+			name: "months aligned to first day", from: "2026-01-15", to: "2026-12-31", grouping: GroupingMonth,
+			want: [][2]string{
+				{"2026-01-15", "2026-03-31"}, {"2026-04-01", "2026-05-31"}, {"2026-06-01", "2026-07-31"},
+				{"2026-08-01", "2026-09-30"}, {"2026-10-01", "2026-11-30"}, {"2026-12-01", "2026-12-31"},
+			},
+		},
+		{
+			// 29 марта в Берлине переход на летнее время: в первом куске на час меньше 90 суток,
+			// но дней в нём всё равно 90
+			name: "days across DST", from: "2026-01-01", to: "2026-07-19", grouping: GroupingDay, loc: berlin,
+			want: [][2]string{{"2026-01-01", "2026-03-31"}, {"2026-04-01", "2026-06-29"}, {"2026-06-30", "2026-07-19"}},
+		},
+		{
+			// 25 октября — обратный переход, в куске на час больше
+			name: "days across DST end", from: "2026-09-01", to: "2026-12-31", grouping: GroupingDay, loc: berlin,
+			want: [][2]string{{"2026-09-01", "2026-11-29"}, {"2026-11-30", "2026-12-31"}},
+		},
+		{
+			name: "time of day is ignored", from: "2026-02-01 15:00", to: "2026-02-03 23:00", grouping: GroupingDay,
+			want: [][2]string{{"2026-02-01", "2026-02-03"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			chunks := historyChunks(dayIn(tt.from, loc), dayIn(tt.to, loc), tt.grouping)
+			got := make([][2]string, 0, len(chunks))
+			for _, c := range chunks {
+				got = append(got, [2]string{c[0].Format(dateLayout), c[1].Format(dateLayout)})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("chunks = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunk %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// Свойства разбиения на длинном диапазоне: куски подряд, без пропусков, не длиннее historyChunkDays
+// и начинаются с начала периода группировки. Берлин — с переходами на летнее время и обратно
+func TestHistoryChunksInvariants(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []*time.Location{time.UTC, berlin} {
+		from, to := dayIn("2024-02-14", loc), dayIn("2026-11-03", loc)
+		for _, grouping := range []string{GroupingDay, GroupingWeek, GroupingMonth} {
+			t.Run(loc.String()+"/"+grouping, func(t *testing.T) {
+				chunks := historyChunks(from, to, grouping)
+				if !chunks[0][0].Equal(from) || !chunks[len(chunks)-1][1].Equal(to) {
+					t.Fatalf("chunks cover %s..%s, want %s..%s", chunks[0][0], chunks[len(chunks)-1][1], from, to)
+				}
+				for i, c := range chunks {
+					if last := c[0].AddDate(0, 0, historyChunkDays-1); c[1].After(last) {
+						t.Errorf("chunk %d %s..%s is longer than %d days", i, c[0].Format(dateLayout), c[1].Format(dateLayout), historyChunkDays)
+					}
+					if i == 0 {
+						continue
+					}
+					if !c[0].Equal(chunks[i-1][1].AddDate(0, 0, 1)) {
+						t.Errorf("chunk %d starts %s, previous ends %s", i, c[0], chunks[i-1][1])
+					}
+					switch grouping {
+					case GroupingWeek:
+						if c[0].Weekday() != time.Monday {
+							t.Errorf("chunk %d starts on %s, want Monday", i, c[0].Weekday())
+						}
+					case GroupingMonth:
+						if c[0].Day() != 1 {
+							t.Errorf("chunk %d starts on day %d, want the 1st", i, c[0].Day())
+						}
+					}
+				}
+			})
+		}
+	}
+}
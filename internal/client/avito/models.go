@@ -1,5 +1,7 @@
 package avito
 
+import "time"
+
 type AvitoTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int    `json:"expires_in"`
@@ -27,6 +29,7 @@ type AvitoMetricsResult struct {
 
 type AvitoGrouping struct {
 	ID      int           `json:"id"`
+	Date    string        `json:"date,omitempty"` // начало периода для группировок day/week/month
 	Metrics []AvitoMetric `json:"metrics"`
 	Type    string        `json:"type"`
 }
@@ -37,13 +40,24 @@ type AvitoMetric struct {
 }
 
 type ItemMetrics struct {
-	ID                     int64
-	Link                   string
-	Title                  string
-	Impressions            int
-	Views                  int
-	Contacts               int
-	Spending               int
-	BidPenny               int
-	CostPerContactLastHour float64
+	ID                  int64
+	Link                string
+	Title               string
+	Impressions         int
+	Views               int
+	Contacts            int
+	Spending            int
+	BidPenny            int
+	CostPerContactToday float64 // расход за день / контакты за день, в копейках
+}
+
+// Account — учётные данные магазина для запросов к Avito
+type Account struct {
+	Name         string
+	UserId       int
+	ClientId     string
+	ClientSecret string
+	RetryBudget  int            // 0 — бюджет из RetryPolicy клиента
+	Budget       *Budget        // повторы запуска магазина, см. AvitoClient.NewBudget. nil — свой бюджет на каждый вызов
+	Location     *time.Location // пояс, в котором считается «сегодня» для статистики. nil — clock.DefaultZone
 }
@@ -0,0 +1,217 @@
+package avito
+
+import (
+	"avitoproject/internal/monitoring"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int           // попыток на один запрос, включая первую
+	BaseDelay   time.Duration // задержка перед первым повтором, дальше растёт вдвое
+	MaxDelay    time.Duration // потолок задержки: более долгий Retry-After сокращается до MaxDelay
+	Budget      int           // повторов на один магазин за запуск, по всем эндпоинтам, см. Account.Budget
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    90 * time.Second,
+	Budget:      10,
+}
+
+// Незаполненные поля берутся из DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.Budget <= 0 {
+		p.Budget = DefaultRetryPolicy.Budget
+	}
+	return p
+}
+
+// Budget — остаток повторов магазина на один запуск. Общий для всех запросов запуска,
+// поэтому worker создаёт его через NewBudget и передаёт в Account.Budget
+type Budget struct {
+	mu   sync.Mutex
+	left int
+}
+
+// NewBudget — бюджет повторов на один запуск магазина: Account.RetryBudget или RetryPolicy.Budget
+func (a *AvitoClient) NewBudget(acc Account) *Budget {
+	if acc.RetryBudget > 0 {
+		return &Budget{left: acc.RetryBudget}
+	}
+	return &Budget{left: a.retry.Budget}
+}
+
+// budgetFor — бюджет запуска из acc, а без него — отдельный бюджет на вызов метода клиента
+func (a *AvitoClient) budgetFor(acc Account) *Budget {
+	if acc.Budget != nil {
+		return acc.Budget
+	}
+	return a.NewBudget(acc)
+}
+
+func (b *Budget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.left <= 0 {
+		return false
+	}
+	b.left--
+	return true
+}
+
+// Left — сколько повторов осталось
+func (b *Budget) Left() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.left
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// send выполняет запрос с повторами на сетевых ошибках, 429 и 5xx.
+// build вызывается на каждой попытке с контекстом, ограниченным таймаутом попытки.
+// При неуспешном статусе возвращает и ответ, и типизированную ошибку из errors.go
+func (a *AvitoClient) send(ctx context.Context, acc Account, budget *Budget, endpoint string, build func(ctx context.Context) (*http.Request, error)) (*response, error) {
+	for attempt := 1; ; attempt++ {
+		if err := a.limits.Wait(ctx, acc.ClientId); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := a.attempt(ctx, build)
+		status := 0
+		if err == nil {
+			status = resp.status
+		}
+		monitoring.AvitoRequest(endpoint, status, time.Since(start))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && resp.status == http.StatusOK {
+			return resp, nil
+		}
+		if err == nil && !retryableStatus(resp.status) {
+			return resp, a.statusError(acc, endpoint, resp)
+		}
+
+		delay := a.backoff(attempt)
+		if err == nil {
+			if hint, ok := retryHint(resp.header, a.clock.Now()); ok {
+				delay = hint
+			}
+		}
+
+		// Retry-After дольше потолка не повод сдаваться: ждём MaxDelay и пробуем снова
+		delay = min(delay, a.retry.MaxDelay)
+
+		if attempt >= a.retry.MaxAttempts || !budget.take() {
+			if err != nil {
+				return nil, err
+			}
+			return resp, a.statusError(acc, endpoint, resp)
+		}
+
+		fields := []zap.Field{
+			zap.String("shop", acc.Name),
+			zap.String("endpoint", endpoint),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Int("budgetLeft", budget.Left()),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("status", resp.status))
+		}
+		a.logger.Warn("retrying Avito request", fields...)
+
+		select {
+		case <-a.clock.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt — одна попытка запроса с собственным дедлайном
+func (a *AvitoClient) attempt(ctx context.Context, build func(ctx context.Context) (*http.Request, error)) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	req, err := build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: body}, nil
+}
+
+// Экспоненциальная задержка со случайным разбросом в пределах половины
+func (a *AvitoClient) backoff(attempt int) time.Duration {
+	d := a.retry.BaseDelay << (attempt - 1)
+	if d <= 0 || d > a.retry.MaxDelay {
+		d = a.retry.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryHint читает Retry-After (секунды или HTTP-дата) и X-RateLimit-Reset (секунды или unix-время).
+// Даты отсчитываются от now
+func retryHint(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+			return time.Duration(sec) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil && v >= 0 {
+			// большие значения — это unix-время, а не количество секунд
+			if v > 1_000_000_000 {
+				return max(time.Unix(v, 0).Sub(now), 0), true
+			}
+			return time.Duration(v) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package avito
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryHint(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "no headers", header: http.Header{}},
+		{name: "retry-after seconds", header: http.Header{"Retry-After": {"30"}}, want: 30 * time.Second, wantOk: true},
+		{name: "retry-after date", header: http.Header{"Retry-After": {now.Add(2 * time.Minute).Format(http.TimeFormat)}}, want: 2 * time.Minute, wantOk: true},
+		{name: "retry-after date in the past", header: http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, want: 0, wantOk: true},
+		{name: "reset seconds", header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"15"}}, want: 15 * time.Second, wantOk: true},
+		{name: "reset unix time", header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1792238445"}},
+			want: time.Unix(1792238445, 0).Sub(now), wantOk: true},
+		{name: "reset with requests left", header: http.Header{"X-Ratelimit-Remaining": {"3"}, "X-Ratelimit-Reset": {"15"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryHint(tt.header, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("retryHint = %s, %v; want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package avito_test
+
+import (
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/client/avito/avitofake"
+	"avitoproject/internal/clock"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const statsPath = "/stats/v2/accounts/1/items"
+
+// newTestClient — клиент поверх фейка Avito на фейковых часах; BaseUrl и Clock в opts заполняются здесь
+func newTestClient(t *testing.T, opts avito.Options) (*avito.AvitoClient, *avitofake.Server, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	srv := avitofake.NewServer()
+	srv.SetClock(clk)
+	srv.AddAccount(avitofake.Account{UserId: 1, ClientId: "client", ClientSecret: "secret",
+		Items: []avitofake.Item{{ID: 1, Impressions: 100, Spending: 5000}}})
+	t.Cleanup(srv.Close)
+
+	opts.BaseUrl, opts.Clock = srv.Start(), clk
+	client := avito.NewAvitoClient(zap.NewNop(), opts)
+	return client, srv, clk
+}
+
+func testAccount() avito.Account {
+	return avito.Account{Name: "main", UserId: 1, ClientId: "client", ClientSecret: "secret", Location: time.UTC}
+}
+
+// advanceWhenWaiting ждёт, пока клиент уснёт перед повтором, и переводит часы на d
+func advanceWhenWaiting(t *testing.T, clk *clock.Fake, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clk.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not wait before retrying")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(d)
+}
+
+func TestRetryAfterLongerThanMaxDelayIsClamped(t *testing.T) {
+	client, srv, clk := newTestClient(t, avito.Options{Retry: avito.RetryPolicy{MaxAttempts: 2, MaxDelay: 90 * time.Second}})
+	srv.FailNext(statsPath, avitofake.Failure{Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"120"}}})
+
+	type result struct {
+		data avito.AvitoMetricsData
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := client.GetAvitoMetrics(context.Background(), testAccount())
+		done <- result{data, err}
+	}()
+
+	advanceWhenWaiting(t, clk, 90*time.Second)
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("GetAvitoMetrics: %v", res.err)
+	}
+	if res.data.Impressions != 100 {
+		t.Errorf("Impressions = %d, want 100", res.data.Impressions)
+	}
+}
+
+func TestBudgetIsSharedAcrossCallsOfOneRun(t *testing.T) {
+	client, srv, clk := newTestClient(t, avito.Options{Retry: avito.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}})
+	acc := testAccount()
+	acc.RetryBudget = 1
+	acc.Budget = client.NewBudget(acc)
+
+	// первый вызов тратит единственный повтор
+	srv.FailNext(statsPath, avitofake.Failure{Status: http.StatusInternalServerError})
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetAvitoMetrics(context.Background(), acc)
+		done <- err
+	}()
+	advanceWhenWaiting(t, clk, time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if left := acc.Budget.Left(); left != 0 {
+		t.Fatalf("budget left = %d, want 0", left)
+	}
+
+	// второй вызов того же запуска повторять уже не может
+	srv.FailNext(statsPath, avitofake.Failure{Status: http.StatusInternalServerError})
+	if _, err := client.GetAvitoMetrics(context.Background(), acc); err == nil {
+		t.Fatal("second call succeeded, want error without retry")
+	}
+
+	// без общего бюджета каждый вызов получает свой
+	srv.FailNext(statsPath, avitofake.Failure{Status: http.StatusInternalServerError})
+	go func() {
+		_, err := client.GetAvitoMetrics(context.Background(), testAccount())
+		done <- err
+	}()
+	advanceWhenWaiting(t, clk, time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("call with its own budget: %v", err)
+	}
+}
+
+func TestCancelStopsRetries(t *testing.T) {
+	client, srv, clk := newTestClient(t, avito.Options{Retry: avito.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Minute, MaxDelay: time.Minute}})
+	srv.FailNext(statsPath,
+		avitofake.Failure{Status: http.StatusInternalServerError},
+		avitofake.Failure{Status: http.StatusInternalServerError},
+		avitofake.Failure{Status: http.StatusInternalServerError})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetAvitoMetrics(ctx, testAccount())
+		done <- err
+	}()
+
+	// клиент уснул перед повтором: отмена будит его сразу, часы не двигаются
+	advanceWhenWaiting(t, clk, 0)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client kept waiting for the backoff after ctx was cancelled")
+	}
+	if n := srv.Requests(statsPath); n != 1 {
+		t.Errorf("stats requested %d times, want 1: no retries after cancel", n)
+	}
+
+	// с уже отменённым ctx запрос не уходит вовсе
+	if _, err := client.GetAvitoMetrics(ctx, testAccount()); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if n := srv.Requests(statsPath); n != 1 {
+		t.Errorf("stats requested %d times, want 1", n)
+	}
+}
+
+func TestAttemptTimeoutCutsOffHangingEndpoint(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	t.Run("retried", func(t *testing.T) {
+		client, srv, clk := newTestClient(t, avito.Options{Timeout: timeout, Retry: avito.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second}})
+		srv.FailNext(statsPath, avitofake.Failure{Hang: true})
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.GetAvitoMetrics(context.Background(), testAccount())
+			done <- err
+		}()
+
+		// зависшая попытка обрывается по таймауту и повторяется после паузы
+		advanceWhenWaiting(t, clk, time.Second)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("GetAvitoMetrics: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("hanging attempt was not cut off")
+		}
+		if n := srv.Requests(statsPath); n != 2 {
+			t.Errorf("stats requested %d times, want 2", n)
+		}
+	})
+
+	t.Run("last attempt", func(t *testing.T) {
+		client, srv, _ := newTestClient(t, avito.Options{Timeout: timeout, Retry: avito.RetryPolicy{MaxAttempts: 1}})
+		srv.FailNext(statsPath, avitofake.Failure{Hang: true})
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.GetAvitoMetrics(context.Background(), testAccount())
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("err = %v, want context.DeadlineExceeded", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("hanging attempt was not cut off by the %s timeout", timeout)
+		}
+	})
+}
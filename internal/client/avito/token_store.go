@@ -0,0 +1,129 @@
+package avito
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Token struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// TokenStore — хранилище токенов, ключ = client_id магазина.
+// Реализации должны быть безопасны для конкурентного использования
+type TokenStore interface {
+	Get(clientId string) (Token, bool)
+	Set(clientId string, token Token) error
+	Delete(clientId string) error
+}
+
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]Token
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]Token)}
+}
+
+func (s *MemoryTokenStore) Get(clientId string) (Token, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[clientId]
+	return t, ok
+}
+
+func (s *MemoryTokenStore) Set(clientId string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[clientId] = token
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete(clientId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, clientId)
+	return nil
+}
+
+// FileTokenStore держит токены в памяти и сохраняет их в JSON-файл при каждом изменении,
+// чтобы после рестарта не запрашивать новый токен для каждого магазина
+type FileTokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens map[string]Token
+}
+
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	s := &FileTokenStore{path: path, tokens: make(map[string]Token)}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token cache: %w", err)
+	}
+	if err := json.Unmarshal(b, &s.tokens); err != nil {
+		return nil, fmt.Errorf("unable to parse token cache: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileTokenStore) Get(clientId string) (Token, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[clientId]
+	return t, ok
+}
+
+func (s *FileTokenStore) Set(clientId string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[clientId] = token
+	return s.save()
+}
+
+func (s *FileTokenStore) Delete(clientId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, clientId)
+	return s.save()
+}
+
+// вызывается под s.mu; пишем во временный файл и переименовываем, чтобы не получить обрезанный JSON
+func (s *FileTokenStore) save() error {
+	b, err := json.Marshal(s.tokens)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	return nil
+}
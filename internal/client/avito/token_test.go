@@ -0,0 +1,39 @@
+package avito_test
+
+import (
+	"avitoproject/internal/client/avito"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenRefreshedBeforeExpiry(t *testing.T) {
+	client, srv, clk := newTestClient(t, avito.Options{Retry: avito.RetryPolicy{MaxAttempts: 1}})
+	srv.SetTokenTTL(time.Hour)
+	ctx := context.Background()
+
+	steps := []struct {
+		advance    time.Duration
+		wantIssued int
+	}{
+		{advance: 0, wantIssued: 1},
+		{advance: 50 * time.Minute, wantIssued: 1}, // до истечения больше запаса в 5 минут
+		{advance: 6 * time.Minute, wantIssued: 2},  // осталось 4 минуты — токен обновляется заранее
+		{advance: 30 * time.Minute, wantIssued: 2},
+		{advance: 2 * time.Hour, wantIssued: 3}, // давно истёк
+	}
+	for i, step := range steps {
+		clk.Advance(step.advance)
+		if _, err := client.GetAvitoMetrics(ctx, testAccount()); err != nil {
+			t.Fatalf("step %d: GetAvitoMetrics: %v", i, err)
+		}
+		if got := srv.TokensIssued(); got != step.wantIssued {
+			t.Errorf("step %d: tokens issued = %d, want %d", i, got, step.wantIssued)
+		}
+	}
+
+	exp, ok := client.TokenExpiry("client")
+	if !ok || !exp.Equal(clk.Now().Add(time.Hour)) {
+		t.Errorf("TokenExpiry = %v, %v; want %v", exp, ok, clk.Now().Add(time.Hour))
+	}
+}
@@ -7,14 +7,32 @@ import (
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 	"os"
+	"time"
 )
 
+const DefaultTimeout = 30 * time.Second
+
+// SheetsAPI — вызовы Google Sheets, которые использует приложение.
+// Реализации: *Client для настоящей таблицы и sheetsfake.Sheets в памяти
+type SheetsAPI interface {
+	UpdateSheet(ctx context.Context, r string, values [][]interface{}) error
+	BatchUpdate(ctx context.Context, data map[string][][]interface{}) error
+	ReadRange(ctx context.Context, r string) ([][]interface{}, error)
+	BatchRead(ctx context.Context, ranges []string) ([][][]interface{}, error)
+	BatchClear(ctx context.Context, ranges []string) error
+	AppendRows(ctx context.Context, r string, values [][]interface{}) error
+}
+
+var _ SheetsAPI = (*Client)(nil)
+
 type Client struct {
 	Service       *sheets.Service
 	SpreadsheetID string
+	timeout       time.Duration // на один вызов Sheets API
 }
 
-func NewGoogleClient(serviceAccountPath, spreadsheetID string) (*Client, error) {
+// timeout <= 0 — DefaultTimeout
+func NewGoogleClient(serviceAccountPath, spreadsheetID string, timeout time.Duration) (*Client, error) {
 	b, err := os.ReadFile(serviceAccountPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read service account file: %w", err)
@@ -30,8 +48,13 @@ func NewGoogleClient(serviceAccountPath, spreadsheetID string) (*Client, error)
 		return nil, fmt.Errorf("unable to create sheets service: %w", err)
 	}
 
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
 	return &Client{
 		Service:       srv,
 		SpreadsheetID: spreadsheetID,
+		timeout:       timeout,
 	}, nil
 }
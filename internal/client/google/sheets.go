@@ -1,21 +1,35 @@
 package google
 
 import (
+	"avitoproject/internal/monitoring"
+	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/sheets/v4"
+	"net/http"
+	"time"
 )
 
-func (c *Client) UpdateSheet(shopRange string, values [][]interface{}) error {
+func (c *Client) UpdateSheet(ctx context.Context, shopRange string, values [][]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
 	vr := &sheets.ValueRange{Values: values}
+	start := time.Now()
 	_, err := c.Service.Spreadsheets.Values.Update(c.SpreadsheetID, shopRange, vr).
-		ValueInputOption("RAW").Do()
+		ValueInputOption("RAW").Context(ctx).Do()
+	observe("update", start, err)
 	if err != nil {
 		return fmt.Errorf("unable to update sheet: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) BatchUpdate(data map[string][][]interface{}) error {
+func (c *Client) BatchUpdate(ctx context.Context, data map[string][][]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
 	requests := []*sheets.ValueRange{}
 	for r, values := range data {
 		requests = append(requests, &sheets.ValueRange{
@@ -23,20 +37,93 @@ func (c *Client) BatchUpdate(data map[string][][]interface{}) error {
 			Values: values,
 		})
 	}
+	start := time.Now()
 	_, err := c.Service.Spreadsheets.Values.BatchUpdate(c.SpreadsheetID, &sheets.BatchUpdateValuesRequest{
 		ValueInputOption: "RAW",
 		Data:             requests,
-	}).Do()
+	}).Context(ctx).Do()
+	observe("batch_update", start, err)
 	if err != nil {
 		return fmt.Errorf("batch update failed: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) ReadRange(r string) ([][]interface{}, error) {
-	resp, err := c.Service.Spreadsheets.Values.Get(c.SpreadsheetID, r).Do()
+func (c *Client) ReadRange(ctx context.Context, r string) ([][]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := c.Service.Spreadsheets.Values.Get(c.SpreadsheetID, r).Context(ctx).Do()
+	observe("read", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read range %s: %w", r, err)
 	}
 	return resp.Values, nil
 }
+
+// BatchRead читает несколько диапазонов за один вызов, результат в порядке ranges
+func (c *Client) BatchRead(ctx context.Context, ranges []string) ([][][]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := c.Service.Spreadsheets.Values.BatchGet(c.SpreadsheetID).Ranges(ranges...).Context(ctx).Do()
+	observe("batch_read", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("batch read failed: %w", err)
+	}
+
+	res := make([][][]interface{}, len(ranges))
+	for i, vr := range resp.ValueRanges {
+		if i < len(res) {
+			res[i] = vr.Values
+		}
+	}
+	return res, nil
+}
+
+// BatchClear очищает значения диапазонов, не трогая форматирование
+func (c *Client) BatchClear(ctx context.Context, ranges []string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Service.Spreadsheets.Values.BatchClear(c.SpreadsheetID, &sheets.BatchClearValuesRequest{
+		Ranges: ranges,
+	}).Context(ctx).Do()
+	observe("batch_clear", start, err)
+	if err != nil {
+		return fmt.Errorf("batch clear failed: %w", err)
+	}
+	return nil
+}
+
+// AppendRows дописывает строки после последней заполненной строки таблицы в диапазоне
+func (c *Client) AppendRows(ctx context.Context, r string, values [][]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	vr := &sheets.ValueRange{Values: values}
+	start := time.Now()
+	_, err := c.Service.Spreadsheets.Values.Append(c.SpreadsheetID, r, vr).
+		ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	observe("append", start, err)
+	if err != nil {
+		return fmt.Errorf("unable to append rows to %s: %w", r, err)
+	}
+	return nil
+}
+
+// observe пишет длительность и код ответа вызова в метрики
+func observe(op string, start time.Time, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = 0
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) {
+			status = apiErr.Code
+		}
+	}
+	monitoring.SheetsRequest(op, status, time.Since(start))
+}
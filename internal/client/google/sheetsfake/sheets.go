@@ -0,0 +1,270 @@
+// Package sheetsfake — таблица Google Sheets в памяти процесса.
+// Реализует google.SheetsAPI и понимает диапазоны в нотации A1, см. пакет a1. Подходит для тестов и стейджинга.
+package sheetsfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"avitoproject/internal/a1"
+	"avitoproject/internal/client/google"
+)
+
+// DefaultSheet — лист для диапазонов без имени листа
+const DefaultSheet = a1.DefaultSheet
+
+var _ google.SheetsAPI = (*Sheets)(nil)
+
+type cell struct {
+	row, col int // с нуля
+}
+
+type Sheets struct {
+	mu       sync.Mutex
+	sheets   map[string]map[cell]interface{} // лист -> непустые ячейки
+	failures []error                         // очередь ошибок для следующих вызовов
+	calls    map[string]int                  // число вызовов по операции
+}
+
+func New() *Sheets {
+	return &Sheets{
+		sheets: make(map[string]map[cell]interface{}),
+		calls:  make(map[string]int),
+	}
+}
+
+// FailNext ставит ошибки в очередь: каждый следующий вызов забирает по одной
+func (s *Sheets) FailNext(errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, errs...)
+}
+
+// Calls — число вызовов операции: update, batch_update, read, batch_read, batch_clear, append
+func (s *Sheets) Calls(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// вызывается под s.mu
+func (s *Sheets) begin(op string) error {
+	s.calls[op]++
+	if len(s.failures) == 0 {
+		return nil
+	}
+	err := s.failures[0]
+	s.failures = s.failures[1:]
+	return err
+}
+
+// UpdateSheet записывает values, начиная с левой верхней ячейки диапазона.
+// Как и настоящий API, пустой values ничего не меняет, а пустая строка очищает ячейку
+func (s *Sheets) UpdateSheet(ctx context.Context, r string, values [][]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("update"); err != nil {
+		return err
+	}
+	return s.update(r, values)
+}
+
+func (s *Sheets) BatchUpdate(ctx context.Context, data map[string][][]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("batch_update"); err != nil {
+		return err
+	}
+	// настоящий API проверяет все диапазоны до записи
+	for r := range data {
+		if _, err := a1.Parse(r); err != nil {
+			return err
+		}
+	}
+	for r, values := range data {
+		if err := s.update(r, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRange возвращает значения диапазона строками, как FORMATTED_VALUE в настоящем API.
+// Пустые строки и колонки в конце отбрасываются, пустые ячейки внутри — ""
+func (s *Sheets) ReadRange(ctx context.Context, r string) ([][]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("read"); err != nil {
+		return nil, err
+	}
+	return s.read(r)
+}
+
+func (s *Sheets) BatchRead(ctx context.Context, ranges []string) ([][][]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("batch_read"); err != nil {
+		return nil, err
+	}
+	res := make([][][]interface{}, 0, len(ranges))
+	for _, r := range ranges {
+		values, err := s.read(r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, values)
+	}
+	return res, nil
+}
+
+func (s *Sheets) BatchClear(ctx context.Context, ranges []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("batch_clear"); err != nil {
+		return err
+	}
+	rects := make([]a1.Range, 0, len(ranges))
+	for _, r := range ranges {
+		rc, err := a1.Parse(r)
+		if err != nil {
+			return err
+		}
+		rects = append(rects, rc)
+	}
+	for _, rc := range rects {
+		for c := range s.sheets[rc.Sheet] {
+			if contains(rc, c) {
+				delete(s.sheets[rc.Sheet], c)
+			}
+		}
+	}
+	return nil
+}
+
+// AppendRows дописывает строки под последней непустой строкой диапазона, начиная с его первой колонки
+func (s *Sheets) AppendRows(ctx context.Context, r string, values [][]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("append"); err != nil {
+		return err
+	}
+	rc, err := a1.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	next := rc.R1
+	for c := range s.sheets[rc.Sheet] {
+		if contains(rc, c) && c.row >= next {
+			next = c.row + 1
+		}
+	}
+	rc.R1, rc.R2 = next, -1
+	return s.write(rc, values)
+}
+
+func (s *Sheets) update(r string, values [][]interface{}) error {
+	rc, err := a1.Parse(r)
+	if err != nil {
+		return err
+	}
+	return s.write(rc, values)
+}
+
+func (s *Sheets) write(rc a1.Range, values [][]interface{}) error {
+	for i, row := range values {
+		for j := range row {
+			if !contains(rc, cell{rc.R1 + i, rc.C1 + j}) {
+				return fmt.Errorf("values do not fit into range %s", rc)
+			}
+		}
+	}
+
+	sheet := s.sheets[rc.Sheet]
+	if sheet == nil {
+		sheet = make(map[cell]interface{})
+		s.sheets[rc.Sheet] = sheet
+	}
+	for i, row := range values {
+		for j, v := range row {
+			c := cell{rc.R1 + i, rc.C1 + j}
+			switch {
+			case v == nil: // null в API оставляет ячейку как есть
+			case v == "":
+				delete(sheet, c)
+			default:
+				sheet[c] = v
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Sheets) read(r string) ([][]interface{}, error) {
+	rc, err := a1.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lastRow, lastCol := -1, -1
+	for c := range s.sheets[rc.Sheet] {
+		if contains(rc, c) {
+			lastRow = max(lastRow, c.row)
+			lastCol = max(lastCol, c.col)
+		}
+	}
+	if lastRow < 0 {
+		return nil, nil
+	}
+
+	values := make([][]interface{}, 0, lastRow-rc.R1+1)
+	for row := rc.R1; row <= lastRow; row++ {
+		line := []interface{}{}
+		for col := rc.C1; col <= lastCol; col++ {
+			v, ok := s.sheets[rc.Sheet][cell{row, col}]
+			if !ok {
+				line = append(line, "")
+				continue
+			}
+			line = append(line, fmt.Sprint(v))
+		}
+		// пустые ячейки в конце строки API не возвращает
+		for len(line) > 0 && line[len(line)-1] == "" {
+			line = line[:len(line)-1]
+		}
+		values = append(values, line)
+	}
+	return values, nil
+}
+
+// Dump — непустые ячейки листа в нотации A1 с исходными значениями, для диагностики
+func (s *Sheets) Dump(sheet string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]interface{}, len(s.sheets[sheet]))
+	for c, v := range s.sheets[sheet] {
+		res[a1.ColName(c.col)+strconv.Itoa(c.row+1)] = v
+	}
+	return res
+}
+
+// SheetNames — имена листов, в которые что-то писали
+func (s *Sheets) SheetNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.sheets))
+	for name := range s.sheets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(r a1.Range, c cell) bool {
+	return r.Contains(c.row, c.col)
+}
@@ -0,0 +1,32 @@
+package clock
+
+import "time"
+
+// Clock — источник текущего времени. В коде демона вместо time.Now и таймеров,
+// чтобы логику слотов, полуночи и истечения токенов можно было прогнать на Fake
+type Clock interface {
+	Now() time.Time
+	// After отправляет время в канал, когда пройдёт d
+	After(d time.Duration) <-chan time.Time
+}
+
+// System — настоящие часы
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Or возвращает c или System, если c == nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
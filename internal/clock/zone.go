@@ -0,0 +1,88 @@
+// Package clock — текущее время и часовые пояса магазинов. По поясу магазина считаются «сегодня»
+// для запросов статистики, день и слоты снапшотов, ночная очистка и часы выгрузок
+package clock
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // пояса IANA доступны и в образах без системной tzdata
+)
+
+// DefaultZone — пояс по умолчанию: по московскому дню Avito обнуляет дневные счётчики
+const DefaultZone = "Europe/Moscow"
+
+// Load возвращает пояс по имени IANA. Пустое имя — DefaultZone
+func Load(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// Zones — общий пояс и пояса магазинов
+type Zones struct {
+	def   *time.Location
+	shops map[string]*time.Location
+}
+
+// NewZones загружает общий пояс def и пояса магазинов shops (имя магазина -> пояс).
+// Магазин с пустым поясом живёт в общем
+func NewZones(def string, shops map[string]string) (*Zones, error) {
+	defLoc, err := Load(def)
+	if err != nil {
+		return nil, err
+	}
+	z := &Zones{def: defLoc, shops: make(map[string]*time.Location, len(shops))}
+	for shop, name := range shops {
+		if name == "" {
+			continue
+		}
+		loc, err := Load(name)
+		if err != nil {
+			return nil, fmt.Errorf("shop %s: %w", shop, err)
+		}
+		z.shops[shop] = loc
+	}
+	return z, nil
+}
+
+// Default — общий пояс. У nil Zones — DefaultZone
+func (z *Zones) Default() *time.Location {
+	if z == nil {
+		loc, _ := Load(DefaultZone)
+		return loc
+	}
+	return z.def
+}
+
+// Shop — пояс магазина, для неизвестного магазина — общий
+func (z *Zones) Shop(name string) *time.Location {
+	if z != nil {
+		if loc, ok := z.shops[name]; ok {
+			return loc
+		}
+	}
+	return z.Default()
+}
+
+// Day — день момента t в поясе loc, YYYY-MM-DD. nil loc — DefaultZone
+func Day(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = (*Zones)(nil).Default()
+	}
+	return t.In(loc).Format("2006-01-02")
+}
+
+// At — момент времени hhmm ("15:04") в день t по поясу loc
+func At(t time.Time, loc *time.Location, hhmm string) (time.Time, error) {
+	hm, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", hhmm, err)
+	}
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), hm.Hour(), hm.Minute(), 0, 0, loc), nil
+}
@@ -1,40 +1,61 @@
 package cron
 
 import (
+	"avitoproject/config"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/jobs"
 	"avitoproject/internal/worker"
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
 
-	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 )
 
 type Scheduler struct {
-	cron   *cron.Cron
+	cron   *clockCron
+	runner *jobs.Runner
 	worker *worker.Worker
 	logger *zap.Logger
+	cfg    config.Config
+	clock  clock.Clock // часы расписания и задержек jitter
 }
 
-func NewScheduler(logger *zap.Logger, w *worker.Worker) *Scheduler {
-	c := cron.New(cron.WithSeconds()) // включаем секунды для гибкости
+// clk == nil — clock.System. С clock.Fake задачи срабатывают по фейковым часам
+func NewScheduler(logger *zap.Logger, runner *jobs.Runner, w *worker.Worker, cfg config.Config, clk clock.Clock) *Scheduler {
+	clk = clock.Or(clk)
 	return &Scheduler{
-		cron:   c,
+		cron:   newClockCron(clk), // выражения с секундами для гибкости
+		runner: runner,
 		worker: w,
 		logger: logger,
+		cfg:    cfg,
+		clock:  clk,
 	}
 }
 
+// shopGroup — магазины с одинаковым итоговым расписанием задачи, запускаются одним заданием
+type shopGroup struct {
+	schedule config.Schedule
+	shops    []config.Shop
+}
+
+// Start планирует выгрузку итогов и объявлений. Магазины с одинаковым расписанием
+// обрабатываются одним заданием, с переопределённым — своим
 func (s *Scheduler) Start(ctx context.Context) error {
-	// Запускаем воркер сразу при старте
-	s.logger.Info("Initial run of Avito metrics update")
-	go s.worker.ProcessAllShops(ctx)
-
-	// Планируем повторный запуск каждые 10 минут
-	_, err := s.cron.AddFunc("@every 10m", func() {
-		s.logger.Info("Scheduled Avito metrics update")
-		s.worker.ProcessAllShops(ctx)
-	})
-	if err != nil {
-		return err
+	if errs := s.cfg.ValidateSchedules(); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, name := range []string{worker.JobTotals, worker.JobItems} {
+		for _, g := range s.groups(name) {
+			if err := s.add(ctx, s.job(name, g.shops), g.schedule); err != nil {
+				return err
+			}
+		}
 	}
 
 	s.cron.Start()
@@ -42,7 +63,171 @@ func (s *Scheduler) Start(ctx context.Context) error {
 	return nil
 }
 
-func (s *Scheduler) Stop() {
-	s.cron.Stop()
+func (s *Scheduler) add(ctx context.Context, job jobs.Job, sch config.Schedule) error {
+	if err := schedule(ctx, s.cron, s.clock, s.runner, job, sch); err != nil {
+		return err
+	}
+	s.logger.Info("Job scheduled", zap.String("job", job.Name), zap.String("key", job.Key), zap.String("cron", sch.Cron),
+		zap.Duration("jitter", sch.Jitter), zap.Bool("runOnStartup", sch.StartsImmediately()), zap.String("overlap", string(policy(sch))))
+	return nil
+}
+
+// Jobs — задания задачи worker.JobTotals или worker.JobItems по группам магазинов, как их планирует Start.
+// У групп одной задачи свои ключи, чтобы запуск одной группы не блокировал другую;
+// ручной запуск с тем же ключом не накладывается на плановый
+func (s *Scheduler) Jobs(name string) []jobs.Job {
+	var res []jobs.Job
+	for _, g := range s.groups(name) {
+		res = append(res, s.job(name, g.shops))
+	}
+	return res
+}
+
+// Key — ключ задания, в которое по расписанию входит магазин shopName. false — задача для магазина не планируется
+func (s *Scheduler) Key(name, shopName string) (string, bool) {
+	for _, g := range s.groups(name) {
+		for _, shop := range g.shops {
+			if shop.Name == shopName {
+				return jobKey(name, g.shops), true
+			}
+		}
+	}
+	return "", false
+}
+
+// groups — магазины задачи name, сгруппированные по итоговому расписанию в поясе магазина
+func (s *Scheduler) groups(name string) []shopGroup {
+	var shops []config.Shop
+	for _, shop := range s.cfg.Shops {
+		if name == worker.JobItems && shop.ItemsSheetRange == "" {
+			continue
+		}
+		shops = append(shops, shop)
+	}
+	return groupShops(shops, func(shop config.Shop) config.Schedule {
+		sch := s.cfg.ShopSchedules(shop).Totals
+		if name == worker.JobItems {
+			sch = s.cfg.ShopSchedules(shop).Items
+		}
+		return inZone(sch, s.cfg.ShopTimezone(shop))
+	})
+}
+
+// job — задание задачи name для группы магазинов
+func (s *Scheduler) job(name string, shops []config.Shop) jobs.Job {
+	job := jobs.Job{Name: name, Key: jobKey(name, shops)}
+	switch name {
+	case worker.JobTotals:
+		job.Fn = func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+			return worker.Outcomes(s.worker.ProcessShops(ctx, shops)), nil
+		}
+	case worker.JobItems:
+		job.Fn = func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+			return worker.Outcomes(s.worker.ProcessShopsItems(ctx, shops)), nil
+		}
+	}
+	return job
+}
+
+func jobKey(name string, shops []config.Shop) string {
+	names := make([]string, 0, len(shops))
+	for _, shop := range shops {
+		names = append(names, shop.Name)
+	}
+	return name + ":" + strings.Join(names, ",")
+}
+
+// groupShops собирает магазины по расписанию, сохраняя порядок из конфига
+func groupShops(shops []config.Shop, scheduleOf func(config.Shop) config.Schedule) []shopGroup {
+	var groups []shopGroup
+next:
+	for _, shop := range shops {
+		sch := scheduleOf(shop)
+		for i := range groups {
+			if sameSchedule(groups[i].schedule, sch) {
+				groups[i].shops = append(groups[i].shops, shop)
+				continue next
+			}
+		}
+		groups = append(groups, shopGroup{schedule: sch, shops: []config.Shop{shop}})
+	}
+	return groups
+}
+
+// inZone выполняет расписание в поясе zone, если в выражении пояс не указан явно
+func inZone(sch config.Schedule, zone string) config.Schedule {
+	if !strings.HasPrefix(sch.Cron, "TZ=") && !strings.HasPrefix(sch.Cron, "CRON_TZ=") {
+		sch.Cron = "CRON_TZ=" + zone + " " + sch.Cron
+	}
+	return sch
+}
+
+func sameSchedule(a, b config.Schedule) bool {
+	return a.Cron == b.Cron && a.Jitter == b.Jitter && a.StartsImmediately() == b.StartsImmediately() && policy(a) == policy(b)
+}
+
+func policy(sch config.Schedule) jobs.Policy {
+	if sch.Overlap == string(jobs.Queue) {
+		return jobs.Queue
+	}
+	return jobs.Skip
+}
+
+// schedule добавляет задачу в c по sch и, если задан RunOnStartup, запускает её сразу.
+// Все запуски идут через runner; запуски при старте c ждёт так же, как запуски по расписанию
+func schedule(ctx context.Context, c *clockCron, clk clock.Clock, runner *jobs.Runner, job jobs.Job, sch config.Schedule) error {
+	job.Policy = policy(sch)
+	run := func(trigger string) {
+		if !sleepJitter(ctx, clk, sch.Jitter) {
+			return
+		}
+		runner.Run(ctx, job, trigger)
+	}
+
+	if err := c.AddFunc(sch.Cron, func() { run(jobs.TriggerSchedule) }); err != nil {
+		return fmt.Errorf("invalid %s schedule %q: %w", job.Name, sch.Cron, err)
+	}
+
+	if sch.StartsImmediately() {
+		c.Go(func() { run(jobs.TriggerStartup) })
+	}
+	return nil
+}
+
+// sleepJitter ждёт случайное время от 0 до jitter. false — ctx отменён раньше
+func sleepJitter(ctx context.Context, clk clock.Clock, jitter time.Duration) bool {
+	if jitter <= 0 {
+		return true
+	}
+	select {
+	case <-clk.After(rand.N(jitter)):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Wait ждёт уже начатые запуски, при старте и по расписанию, не снимая задачи с расписания.
+// Нужен на фейковых часах: пока часы стоят, новых запусков нет
+func (s *Scheduler) Wait() {
+	s.cron.Wait()
+}
+
+// Stop снимает задачи с расписания и ждёт завершения уже запущенных, но не дольше ctx
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if err := waitStopped(ctx, s.cron); err != nil {
+		return fmt.Errorf("cron scheduler: %w", err)
+	}
 	s.logger.Info("Cron scheduler stopped")
+	return nil
+}
+
+// waitStopped останавливает c и ждёт его запущенные задачи
+func waitStopped(ctx context.Context, c *clockCron) error {
+	select {
+	case <-c.Stop():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs still running: %w", ctx.Err())
+	}
 }
@@ -0,0 +1,130 @@
+package cron
+
+import (
+	"avitoproject/internal/clock"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser разбирает выражения так же, как cron.WithSeconds
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// clockCron — расписание cron, которое ждёт срабатываний через clock.Clock, а не по настоящим часам.
+// Выражения разбирает robfig/cron, задачи так же запускаются каждая в своей горутине.
+// На clock.Fake расписание идёт по фейковым часам
+type clockCron struct {
+	clock   clock.Clock
+	entries []*clockEntry
+	running sync.WaitGroup // запуски по расписанию и через Go
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	stopped chan struct{} // закрывается, когда цикл расписания вышел
+}
+
+type clockEntry struct {
+	schedule cron.Schedule
+	fn       func()
+	next     time.Time
+}
+
+func newClockCron(clk clock.Clock) *clockCron {
+	return &clockCron{clock: clk, stop: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// AddFunc добавляет задачу в расписание. Вызывается до Start
+func (c *clockCron) AddFunc(spec string, fn func()) error {
+	sch, err := cronParser.Parse(spec)
+	if err != nil {
+		return err
+	}
+	c.entries = append(c.entries, &clockEntry{schedule: sch, fn: fn})
+	return nil
+}
+
+// Go выполняет fn в отдельной горутине. Stop и Wait ждут её так же, как запуски по расписанию
+func (c *clockCron) Go(fn func()) {
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		fn()
+	}()
+}
+
+func (c *clockCron) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	go c.run()
+}
+
+func (c *clockCron) run() {
+	defer close(c.stopped)
+
+	now := c.clock.Now()
+	for _, e := range c.entries {
+		e.next = e.schedule.Next(now)
+	}
+	for {
+		next, ok := c.earliest()
+		if !ok {
+			<-c.stop
+			return
+		}
+		select {
+		case now = <-c.clock.After(next.Sub(c.clock.Now())):
+		case <-c.stop:
+			return
+		}
+		for _, e := range c.entries {
+			if !e.next.IsZero() && !e.next.After(now) {
+				c.Go(e.fn)
+				e.next = e.schedule.Next(now)
+			}
+		}
+	}
+}
+
+// earliest — ближайшее срабатывание. false — ни одна задача больше не сработает
+func (c *clockCron) earliest() (time.Time, bool) {
+	var next time.Time
+	for _, e := range c.entries {
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Wait ждёт уже начатые запуски, не снимая задачи с расписания
+func (c *clockCron) Wait() {
+	c.running.Wait()
+}
+
+// Stop снимает задачи с расписания. Возвращённый канал закрывается, когда завершатся уже начатые запуски
+func (c *clockCron) Stop() <-chan struct{} {
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	started := c.started
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		if started {
+			<-c.stopped
+		}
+		c.running.Wait()
+		close(done)
+	}()
+	return done
+}
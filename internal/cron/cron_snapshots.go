@@ -1,56 +1,95 @@
 package cron
 
 import (
+	"avitoproject/config"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/jobs"
 	"avitoproject/internal/metrics"
 	"context"
-	"github.com/robfig/cron/v3"
+	"fmt"
 	"go.uber.org/zap"
+	"strings"
 )
 
 type SnapshotScheduler struct {
-	cron   *cron.Cron
-	repo   *metrics.RepositoryMetrics
-	logger *zap.Logger
+	cron    *clockCron
+	runner  *jobs.Runner
+	repo    *metrics.RepositoryMetrics
+	service *metrics.ServiceMetrics
+	logger  *zap.Logger
+	cfg     config.Config
+	clock   clock.Clock
 }
 
-func NewSnapshotScheduler(logger *zap.Logger, repo *metrics.RepositoryMetrics) *SnapshotScheduler {
-	c := cron.New(cron.WithSeconds())
+func NewSnapshotScheduler(logger *zap.Logger, runner *jobs.Runner, repo *metrics.RepositoryMetrics, service *metrics.ServiceMetrics, cfg config.Config, clk clock.Clock) *SnapshotScheduler {
+	clk = clock.Or(clk)
 	return &SnapshotScheduler{
-		cron:   c,
-		repo:   repo,
-		logger: logger,
+		cron:    newClockCron(clk),
+		runner:  runner,
+		repo:    repo,
+		service: service,
+		logger:  logger,
+		cfg:     cfg,
+		clock:   clk,
 	}
 }
 
-func (s *SnapshotScheduler) Start(ctx context.Context) {
+func (s *SnapshotScheduler) Start(ctx context.Context) error {
+	schedules := s.cfg.JobSchedules()
 
-	// --- 1. Каждую минуту — проверка и сохранение снапшотов ---
-	_, err := s.cron.AddFunc("0 * * * * *", func() {
-		s.repo.SaveSnapshotsIfDue(ctx)
-	})
+	// --- 1. По расписанию Snapshots (по умолчанию каждую минуту) — проверка и сохранение снапшотов ---
+	err := schedule(ctx, s.cron, s.clock, s.runner, jobs.Job{Name: metrics.JobSnapshots, Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+		return nil, s.service.SaveSnapshotsIfDue(ctx)
+	}}, schedules.Snapshots)
 	if err != nil {
-		s.logger.Fatal("failed to add snapshot cron func", zap.Error(err))
+		return err
 	}
 
-	// --- 2. Каждый день в 00:00 — очистка всех snapshot-диапазонов ---
-	_, err = s.cron.AddFunc("0 0 0 * * *", func() {
-		s.logger.Info("running daily cleanup of all snapshot ranges")
+	// --- 2. По расписанию ClearSnapshots (по умолчанию в 00:00) — архив и очистка snapshot-диапазонов,
+	// отдельно для каждого пояса: у магазина полночь наступает по его времени.
+	// Без sink sheets диапазонов в таблице нет и очищать нечего ---
+	var clear []shopGroup
+	if s.repo != nil {
+		clear = groupShops(s.cfg.Shops, func(shop config.Shop) config.Schedule {
+			return inZone(schedules.ClearSnapshots, s.cfg.ShopTimezone(shop))
+		})
+	}
+	for _, g := range clear {
+		shops := g.shops
+		names := make([]string, 0, len(shops))
+		for _, shop := range shops {
+			names = append(names, shop.Name)
+		}
+		job := jobs.Job{Name: "clear_snapshots", Key: "clear_snapshots:" + strings.Join(names, ","), Fn: func(ctx context.Context) ([]jobs.ShopOutcome, error) {
+			s.logger.Info("running daily cleanup of snapshot ranges", zap.Strings("shops", names))
 
-		if err := s.repo.ClearAllSnapshotRanges(ctx); err != nil {
-			s.logger.Error("failed to clear snapshot ranges", zap.Error(err))
-		} else {
-			s.logger.Info("all snapshot ranges cleared successfully")
+			if err := s.repo.ClearSnapshotRanges(ctx, shops); err != nil {
+				s.logger.Error("failed to clear snapshot ranges", zap.Strings("shops", names), zap.Error(err))
+				return nil, err
+			}
+			s.logger.Info("snapshot ranges cleared successfully", zap.Strings("shops", names))
+			return nil, nil
+		}}
+		if err := schedule(ctx, s.cron, s.clock, s.runner, job, g.schedule); err != nil {
+			return err
 		}
-	})
-	if err != nil {
-		s.logger.Fatal("failed to add daily clear cron func", zap.Error(err))
 	}
 
 	s.cron.Start()
 	s.logger.Info("Snapshot cron started")
+	return nil
 }
 
-func (s *SnapshotScheduler) Stop() {
-	s.cron.Stop()
+// Wait ждёт уже начатые запуски, не снимая задачи с расписания
+func (s *SnapshotScheduler) Wait() {
+	s.cron.Wait()
+}
+
+// Stop снимает задачи с расписания и ждёт завершения уже запущенных, но не дольше ctx
+func (s *SnapshotScheduler) Stop(ctx context.Context) error {
+	if err := waitStopped(ctx, s.cron); err != nil {
+		return fmt.Errorf("snapshot cron: %w", err)
+	}
 	s.logger.Info("Snapshot cron stopped")
+	return nil
 }
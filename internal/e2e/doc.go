@@ -0,0 +1,4 @@
+// Package e2e — сквозные тесты без сети и Google: настоящие worker, сервис метрик, репозиторий таблиц,
+// jobs.Runner и планировщики cron поверх avitofake, sheetsfake и clock.Fake. Расписания срабатывают
+// по фейковым часам, поэтому сутки работы демона прогоняются за доли секунды
+package e2e
@@ -0,0 +1,142 @@
+package e2e
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/client/avito/avitofake"
+	"avitoproject/internal/client/google/sheetsfake"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/cron"
+	"avitoproject/internal/jobs"
+	"avitoproject/internal/metrics"
+	"avitoproject/internal/worker"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// loops — циклы расписаний стенда: cron.Scheduler и cron.SnapshotScheduler.
+// Между срабатываниями каждый из них ждёт своё After на фейковых часах
+const loops = 2
+
+type harness struct {
+	avito  *avitofake.Server
+	sheets *sheetsfake.Sheets
+	clock  *clock.Fake
+
+	service   *metrics.ServiceMetrics
+	scheduler *cron.Scheduler
+	snapshots *cron.SnapshotScheduler
+}
+
+// newHarness поднимает стенд с часами, выставленными на start. Часы идут в UTC, как на сервере:
+// расписание без пояса магазина сработало бы не по его времени. Аккаунты магазинов cfg регистрируются
+// в фейке Avito, Urls.AvitoBaseUrl указывает на него. Повторы запросов к Avito выключены:
+// паузы между ними шли бы по фейковым часам, которые двигает только сам стенд
+func newHarness(t *testing.T, cfg config.Config, start time.Time) *harness {
+	t.Helper()
+	zones, err := cfg.Zones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &harness{
+		avito:  avitofake.NewServer(),
+		sheets: sheetsfake.New(),
+		clock:  clock.NewFake(start.UTC()),
+	}
+	h.avito.SetClock(h.clock)
+	for _, shop := range cfg.Shops {
+		h.avito.AddAccount(avitofake.Account{UserId: shop.UserId, ClientId: shop.ClientId, ClientSecret: shop.ClientSecret})
+	}
+	cfg.Urls.AvitoBaseUrl = h.avito.Start()
+	t.Cleanup(h.avito.Close)
+
+	logger := zap.NewNop()
+	repo := metrics.NewRepositoryMetrics(logger, cfg, zones, h.clock, h.sheets)
+	sink, err := metrics.NewFanOut(logger, cfg, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemState, _ := metrics.NewItemStateStore("")
+	snapState, _ := metrics.NewSnapshotStateStore("")
+	h.service = metrics.NewServiceMetrics(logger, cfg, zones, h.clock, sink, itemState, snapState)
+
+	client := avito.NewAvitoClient(logger, avito.Options{
+		BaseUrl: cfg.Urls.AvitoBaseUrl,
+		Retry:   avito.RetryPolicy{MaxAttempts: 1},
+		Clock:   h.clock,
+	})
+	w := worker.NewWorker(logger, client, h.service, cfg, zones, h.clock)
+	runner := jobs.NewRunner(logger, 0, h.clock)
+	h.scheduler = cron.NewScheduler(logger, runner, w, cfg, h.clock)
+	h.snapshots = cron.NewSnapshotScheduler(logger, runner, repo, h.service, cfg, h.clock)
+	return h
+}
+
+// start запускает расписания, как при старте демона, и дожидается запусков с RunOnStartup
+func (h *harness) start(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := h.scheduler.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.snapshots.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		stopCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stop()
+		h.scheduler.Stop(stopCtx)
+		h.snapshots.Stop(stopCtx)
+	})
+	h.settle(t)
+}
+
+// runUntil двигает часы до until от срабатывания к срабатыванию, каждый раз дожидаясь
+// запусков, которые оно вызвало
+func (h *harness) runUntil(t *testing.T, until time.Time) {
+	t.Helper()
+	for {
+		next, ok := h.clock.Next()
+		if !ok || next.After(until) {
+			break
+		}
+		h.clock.Set(next)
+		h.settle(t)
+	}
+	if h.clock.Now().Before(until) {
+		h.clock.Set(until)
+	}
+}
+
+// settle ждёт, пока оба цикла расписаний снова встанут на After и начатые ими запуски завершатся
+func (h *harness) settle(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); h.clock.Waiters() < loops; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("schedulers did not return to waiting at %s", h.clock.Now())
+		}
+	}
+	h.scheduler.Wait()
+	h.snapshots.Wait()
+}
+
+// expectRange сверяет значения диапазона таблицы; nil — диапазон пуст
+func (h *harness) expectRange(t *testing.T, r string, want [][]interface{}) {
+	t.Helper()
+	got, err := h.sheets.ReadRange(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s at %s: got %v, want %v", r, h.clock.Now().Format("2006-01-02 15:04 MST"), got, want)
+	}
+}
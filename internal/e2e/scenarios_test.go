@@ -0,0 +1,141 @@
+package e2e
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito/avitofake"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/metrics"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{name: "full_day", run: fullDay},
+		{name: "snapshot_retry", run: snapshotRetry},
+		{name: "items_hourly", run: itemsHourly},
+		{name: "shop_timezone", run: shopTimezone},
+	}
+	for _, sc := range scenarios {
+		t.Run(sc.name, sc.run)
+	}
+}
+
+func testShop() config.Shop {
+	return config.Shop{
+		Name:         "main",
+		ClientId:     "client",
+		ClientSecret: "secret",
+		UserId:       1,
+		SheetRange:   "Totals!B2:B5",
+		Snapshots: []config.SnapshotTime{
+			{Time: "10:00", Range: "Snapshots!B2:E2"},
+			{Time: "14:00", Range: "Snapshots!B3:E3"},
+		},
+	}
+}
+
+func msk(day, hhmm string) time.Time {
+	loc, _ := clock.Load("Europe/Moscow")
+	t, _ := time.ParseInLocation("2006-01-02 15:04", day+" "+hhmm, loc)
+	return t
+}
+
+// fullDay — сутки с полуночи до полуночи: итоги каждые 10 минут, снапшоты в слоты,
+// архив и очистка снапшотов в полночь, токены с часовым сроком жизни
+func fullDay(t *testing.T) {
+	shop := testShop()
+	h := newHarness(t, config.Config{Shops: []config.Shop{shop}, SnapshotArchiveRange: "Archive!A:H"}, msk("2026-10-16", "23:30"))
+	h.avito.SetTokenTTL(time.Hour)
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 1, Impressions: 100, Views: 10, Contacts: 1, Spending: 5000}})
+
+	h.start(t)
+	h.runUntil(t, msk("2026-10-17", "10:05"))
+	h.expectRange(t, "Snapshots!B2:E2", [][]interface{}{{"50", "100", "10", "1"}})
+
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 1, Impressions: 300, Views: 30, Contacts: 3, Spending: 9000}})
+	h.runUntil(t, msk("2026-10-17", "14:05"))
+	h.expectRange(t, "Snapshots!B3:E3", [][]interface{}{{"90", "300", "30", "3"}})
+
+	h.runUntil(t, msk("2026-10-18", "00:05"))
+	h.expectRange(t, "Snapshots!A1:Z", nil)
+	h.expectRange(t, "Archive!A:H", [][]interface{}{
+		{"2026-10-17", "main", "10:00", "50", "100", "10", "1"},
+		{"2026-10-17", "main", "14:00", "90", "300", "30", "3"},
+	})
+
+	// токен живёт час, итоги раз в 10 минут: за 24,5 часа — не меньше 24 обновлений
+	if n := h.avito.TokensIssued(); n < 24 {
+		t.Errorf("tokens issued: got %d, want at least 24", n)
+	}
+	dates := map[string]bool{}
+	for _, d := range h.avito.StatsDates() {
+		dates[d] = true
+	}
+	if !dates["2026-10-16"] || !dates["2026-10-17"] || !dates["2026-10-18"] {
+		t.Errorf("stats dates: got %v, want requests for 16, 17 and 18 October", dates)
+	}
+}
+
+// snapshotRetry — слот 10:00 не снят из-за ошибки таблицы и догоняется на следующем тике
+func snapshotRetry(t *testing.T) {
+	shop := testShop()
+	// итоги в 55 минут каждого часа, чтобы в 10:00 в таблицу писал только снапшот
+	cfg := config.Config{Shops: []config.Shop{shop}, Schedules: config.Schedules{Totals: config.Schedule{Cron: "0 55 * * * *"}}}
+	h := newHarness(t, cfg, msk("2026-10-17", "09:30"))
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 1, Impressions: 100, Spending: 5000}})
+
+	h.start(t)
+	h.runUntil(t, msk("2026-10-17", "09:59"))
+	h.sheets.FailNext(errors.New("sheets unavailable"))
+	h.runUntil(t, msk("2026-10-17", "10:00"))
+	if st := h.service.SnapshotSlots()[shop.Name]["10:00"]; st.Status != metrics.SlotPending || st.Attempts != 1 {
+		t.Fatalf("slot after failure: got %+v, want pending after 1 attempt", st)
+	}
+
+	h.runUntil(t, msk("2026-10-17", "10:02"))
+	st := h.service.SnapshotSlots()[shop.Name]["10:00"]
+	if st.Status != metrics.SlotTaken || st.Attempts != 2 || st.Late != time.Minute {
+		t.Fatalf("slot after retry: got %+v, want taken 1m late on attempt 2", st)
+	}
+	h.expectRange(t, "Snapshots!B2:E2", [][]interface{}{{"50", "100", "0", "0"}})
+}
+
+// itemsHourly — прирост по объявлениям за час и его сброс после полуночи
+func itemsHourly(t *testing.T) {
+	shop := testShop()
+	shop.Snapshots = nil
+	shop.ItemsSheetRange = "Items!A2:O"
+	h := newHarness(t, config.Config{Shops: []config.Shop{shop}}, msk("2026-10-17", "21:30"))
+
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 7, Title: "Sofa", Impressions: 100, Views: 10, Contacts: 1, Spending: 1000}})
+	h.start(t)
+	h.runUntil(t, msk("2026-10-17", "22:30"))
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 7, Title: "Sofa", Impressions: 160, Views: 15, Contacts: 2, Spending: 1600}})
+	h.runUntil(t, msk("2026-10-17", "23:30"))
+	// показы, просмотры, контакты и расход за час — колонки K:N
+	h.expectRange(t, "Items!K2:N2", [][]interface{}{{"60", "5", "1", "6"}})
+
+	// после полуночи счётчики Avito начинаются заново, приростом считается сам счётчик
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 7, Title: "Sofa", Impressions: 20, Views: 2, Contacts: 0, Spending: 300}})
+	h.runUntil(t, msk("2026-10-18", "00:30"))
+	h.expectRange(t, "Items!K2:N2", [][]interface{}{{"20", "2", "0", "3"}})
+}
+
+// shopTimezone — слот 10:00 магазина во Владивостоке снимается в 03:00 по Москве
+func shopTimezone(t *testing.T) {
+	shop := testShop()
+	shop.Timezone = "Asia/Vladivostok"
+	h := newHarness(t, config.Config{Shops: []config.Shop{shop}}, msk("2026-10-17", "02:30"))
+	h.avito.SetItems(shop.ClientId, []avitofake.Item{{ID: 1, Impressions: 100, Spending: 5000}})
+
+	h.start(t)
+	h.runUntil(t, msk("2026-10-17", "02:59"))
+	h.expectRange(t, "Snapshots!B2:E2", nil)
+	h.runUntil(t, msk("2026-10-17", "03:01"))
+	h.expectRange(t, "Snapshots!B2:E2", [][]interface{}{{"50", "100", "0", "0"}})
+}
@@ -0,0 +1,261 @@
+// Package jobs — запуск задач по расписанию: защита от наложения запусков,
+// перехват паник и история запусков с итогом по каждому магазину
+package jobs
+
+import (
+	"avitoproject/internal/clock"
+	"avitoproject/internal/monitoring"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Policy — что делать, если задача запускается, пока предыдущий запуск ещё идёт
+type Policy string
+
+const (
+	Skip  Policy = "skip"  // пропустить новый запуск
+	Queue Policy = "queue" // дождаться окончания текущего, но не дольше ctx; в очереди не больше одного запуска
+)
+
+// Итог запуска
+const (
+	OutcomeOK      = "ok"
+	OutcomeFailed  = "failed" // ошибка задачи или хотя бы одного магазина
+	OutcomePanic   = "panic"
+	OutcomeSkipped = "skipped"
+)
+
+// Источник запуска
+const (
+	TriggerSchedule = "schedule"
+	TriggerStartup  = "startup"
+	TriggerManual   = "manual"
+)
+
+const defaultHistorySize = 500 // запусков на задачу
+
+// ShopOutcome — итог задачи по одному магазину
+type ShopOutcome struct {
+	Shop     string
+	Started  time.Time
+	Finished time.Time
+	Error    string `json:",omitempty"`
+}
+
+// Run — один запуск задачи
+type Run struct {
+	Job      string
+	Key      string
+	Trigger  string
+	Started  time.Time
+	Finished time.Time
+	Outcome  string
+	Error    string        `json:",omitempty"`
+	Shops    []ShopOutcome `json:",omitempty"`
+}
+
+type Job struct {
+	Name   string // имя задачи: totals, items, snapshots, ...
+	Key    string // различает задания одной задачи, например группы магазинов. Пустое — Name
+	Policy Policy // пустое — Skip
+	Fn     func(ctx context.Context) ([]ShopOutcome, error)
+}
+
+type Runner struct {
+	logger      *zap.Logger
+	clock       clock.Clock
+	historySize int
+
+	mu     sync.Mutex
+	states map[string]*jobState
+	// по имени задачи, по возрастанию времени начала, не больше historySize на задачу,
+	// чтобы ежеминутные снапшоты не вытесняли редкие выгрузки
+	history map[string][]Run
+}
+
+type jobState struct {
+	slot    chan struct{} // занят, пока идёт запуск
+	running atomic.Bool   // для Running: проверка флага, в отличие от slot, ничего не захватывает
+	pending atomic.Bool   // запуск ждёт окончания текущего (Queue)
+}
+
+func newJobState() *jobState {
+	return &jobState{slot: make(chan struct{}, 1)}
+}
+
+// tryAcquire занимает задание, если оно свободно
+func (st *jobState) tryAcquire() bool {
+	select {
+	case st.slot <- struct{}{}:
+		st.running.Store(true)
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire ждёт, пока задание освободится, но не дольше ctx
+func (st *jobState) acquire(ctx context.Context) error {
+	select {
+	case st.slot <- struct{}{}:
+		st.running.Store(true)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (st *jobState) release() {
+	st.running.Store(false)
+	<-st.slot
+}
+
+// historySize <= 0 — 500 последних запусков каждой задачи. clk == nil — clock.System
+func NewRunner(logger *zap.Logger, historySize int, clk clock.Clock) *Runner {
+	if historySize <= 0 {
+		historySize = defaultHistorySize
+	}
+	return &Runner{
+		logger:      logger,
+		clock:       clock.Or(clk),
+		historySize: historySize,
+		states:      make(map[string]*jobState),
+		history:     make(map[string][]Run),
+	}
+}
+
+// Run синхронно выполняет задачу с учётом её Policy и возвращает итог запуска
+func (r *Runner) Run(ctx context.Context, job Job, trigger string) Run {
+	key := job.Key
+	if key == "" {
+		key = job.Name
+	}
+	logger := r.logger.With(zap.String("job", job.Name), zap.String("key", key), zap.String("trigger", trigger))
+
+	st := r.state(key)
+	if !st.tryAcquire() {
+		if job.Policy != Queue || !st.pending.CompareAndSwap(false, true) {
+			logger.Warn("Previous run is still in progress, run skipped")
+			return r.record(Run{Job: job.Name, Key: key, Trigger: trigger, Started: r.clock.Now(), Finished: r.clock.Now(), Outcome: OutcomeSkipped})
+		}
+		logger.Info("Previous run is still in progress, run queued")
+		err := st.acquire(ctx)
+		st.pending.Store(false)
+		if err != nil {
+			// остановка демона: ждать окончания текущего запуска больше незачем
+			logger.Warn("Queued run cancelled", zap.Error(err))
+			return r.record(Run{Job: job.Name, Key: key, Trigger: trigger, Started: r.clock.Now(), Finished: r.clock.Now(),
+				Outcome: OutcomeSkipped, Error: err.Error()})
+		}
+	}
+	defer st.release()
+
+	run := Run{Job: job.Name, Key: key, Trigger: trigger, Started: r.clock.Now()}
+	r.execute(ctx, logger, job, &run)
+	run.Finished = r.clock.Now()
+
+	monitoring.JobDuration(job.Name, run.Finished.Sub(run.Started))
+	logger.Debug("Job finished", zap.String("outcome", run.Outcome), zap.Duration("took", run.Finished.Sub(run.Started)))
+	return r.record(run)
+}
+
+// execute выполняет Fn, превращая панику в итог OutcomePanic
+func (r *Runner) execute(ctx context.Context, logger *zap.Logger, job Job, run *Run) {
+	defer func() {
+		if p := recover(); p != nil {
+			run.Outcome = OutcomePanic
+			run.Error = fmt.Sprint(p)
+			logger.Error("Job panicked", zap.Any("panic", p), zap.Stack("stack"))
+		}
+	}()
+
+	shops, err := job.Fn(ctx)
+	run.Shops = shops
+	run.Outcome = OutcomeOK
+	if err != nil {
+		run.Outcome = OutcomeFailed
+		run.Error = err.Error()
+	}
+	for _, s := range shops {
+		if s.Error != "" {
+			run.Outcome = OutcomeFailed
+		}
+	}
+}
+
+// Running — идёт ли сейчас запуск задания key
+func (r *Runner) Running(key string) bool {
+	return r.state(key).running.Load()
+}
+
+// History возвращает последние запуски, новые первыми. Пустые job и shop — без фильтра,
+// limit <= 0 — все сохранённые
+func (r *Runner) History(job, shop string, limit int) []Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []Run
+	for name, runs := range r.history {
+		if job != "" && name != job {
+			continue
+		}
+		for _, run := range runs {
+			if shop != "" {
+				run = withShop(run, shop)
+				if len(run.Shops) == 0 {
+					continue
+				}
+			}
+			res = append(res, run)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Started.After(res[j].Started) })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// withShop оставляет в запуске только итог магазина shop
+func withShop(run Run, shop string) Run {
+	shops := run.Shops
+	run.Shops = nil
+	for _, s := range shops {
+		if s.Shop == shop {
+			run.Shops = []ShopOutcome{s}
+			break
+		}
+	}
+	return run
+}
+
+func (r *Runner) state(key string) *jobState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.states[key]
+	if !ok {
+		st = newJobState()
+		r.states[key] = st
+	}
+	return st
+}
+
+func (r *Runner) record(run Run) Run {
+	monitoring.JobRun(run.Job, run.Outcome)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := append(r.history[run.Job], run)
+	if over := len(runs) - r.historySize; over > 0 {
+		runs = append(runs[:0:0], runs[over:]...)
+	}
+	r.history[run.Job] = runs
+	return run
+}
@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"avitoproject/internal/clock"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// blockingJob — задание, которое идёт, пока не закрыт release; started закрывается при его начале
+func blockingJob(name string, policy Policy) (job Job, started, release chan struct{}) {
+	started, release = make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	job = Job{Name: name, Policy: policy, Fn: func(ctx context.Context) ([]ShopOutcome, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return nil, nil
+	}}
+	return job, started, release
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestSkipPolicy(t *testing.T) {
+	r := NewRunner(zap.NewNop(), 0, nil)
+	ctx := context.Background()
+	job, started, release := blockingJob("totals", Skip)
+
+	done := make(chan Run)
+	go func() { done <- r.Run(ctx, job, TriggerSchedule) }()
+	<-started
+	if !r.Running("totals") {
+		t.Error("Running = false while the job runs")
+	}
+
+	if run := r.Run(ctx, job, TriggerManual); run.Outcome != OutcomeSkipped {
+		t.Errorf("overlapping run outcome = %s, want %s", run.Outcome, OutcomeSkipped)
+	}
+	close(release)
+	if run := <-done; run.Outcome != OutcomeOK {
+		t.Errorf("first run outcome = %s, want %s", run.Outcome, OutcomeOK)
+	}
+	if r.Running("totals") {
+		t.Error("Running = true after the job finished")
+	}
+
+	// другой ключ той же задачи не блокируется
+	other := job
+	other.Key = "totals:other"
+	other.Fn = func(ctx context.Context) ([]ShopOutcome, error) { return nil, nil }
+	if run := r.Run(ctx, other, TriggerManual); run.Outcome != OutcomeOK {
+		t.Errorf("run with another key outcome = %s, want %s", run.Outcome, OutcomeOK)
+	}
+}
+
+func TestQueuePolicy(t *testing.T) {
+	r := NewRunner(zap.NewNop(), 0, nil)
+	ctx := context.Background()
+	job, started, release := blockingJob("items", Queue)
+
+	first := make(chan Run)
+	go func() { first <- r.Run(ctx, job, TriggerSchedule) }()
+	<-started
+
+	queued := make(chan Run)
+	go func() { queued <- r.Run(ctx, job, TriggerSchedule) }()
+	waitFor(t, "the run to be queued", r.state("items").pending.Load)
+
+	// в очереди не больше одного запуска
+	if run := r.Run(ctx, job, TriggerManual); run.Outcome != OutcomeSkipped {
+		t.Errorf("third run outcome = %s, want %s", run.Outcome, OutcomeSkipped)
+	}
+	select {
+	case run := <-queued:
+		t.Fatalf("queued run finished before the first one: %+v", run)
+	default:
+	}
+
+	close(release)
+	if run := <-first; run.Outcome != OutcomeOK {
+		t.Errorf("first run outcome = %s, want %s", run.Outcome, OutcomeOK)
+	}
+	if run := <-queued; run.Outcome != OutcomeOK {
+		t.Errorf("queued run outcome = %s, want %s", run.Outcome, OutcomeOK)
+	}
+}
+
+func TestQueuedRunStopsOnCancel(t *testing.T) {
+	r := NewRunner(zap.NewNop(), 0, nil)
+	job, started, release := blockingJob("items", Queue)
+	defer close(release)
+
+	go r.Run(context.Background(), job, TriggerSchedule)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan Run)
+	go func() { queued <- r.Run(ctx, job, TriggerSchedule) }()
+	waitFor(t, "the run to be queued", r.state("items").pending.Load)
+
+	cancel()
+	select {
+	case run := <-queued:
+		if run.Outcome != OutcomeSkipped || run.Error == "" {
+			t.Errorf("cancelled run = %+v, want skipped with the context error", run)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued run did not return after ctx was cancelled")
+	}
+	if r.state("items").pending.Load() {
+		t.Error("pending flag left set after the queued run was cancelled")
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context) ([]ShopOutcome, error)
+		outcome string
+		err     string
+	}{
+		{name: "ok", fn: func(ctx context.Context) ([]ShopOutcome, error) {
+			return []ShopOutcome{{Shop: "main"}}, nil
+		}, outcome: OutcomeOK},
+		{name: "job error", fn: func(ctx context.Context) ([]ShopOutcome, error) {
+			return nil, errors.New("sheets unavailable")
+		}, outcome: OutcomeFailed, err: "sheets unavailable"},
+		{name: "shop error", fn: func(ctx context.Context) ([]ShopOutcome, error) {
+			return []ShopOutcome{{Shop: "main"}, {Shop: "second", Error: "forbidden"}}, nil
+		}, outcome: OutcomeFailed},
+		{name: "panic", fn: func(ctx context.Context) ([]ShopOutcome, error) {
+			panic("nil map")
+		}, outcome: OutcomePanic, err: "nil map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRunner(zap.NewNop(), 0, nil)
+			job := Job{Name: "totals", Fn: tt.fn}
+			run := r.Run(context.Background(), job, TriggerManual)
+			if run.Outcome != tt.outcome || run.Error != tt.err {
+				t.Errorf("run = %s %q, want %s %q", run.Outcome, run.Error, tt.outcome, tt.err)
+			}
+			// после паники задание не остаётся занятым
+			if r.Running("totals") {
+				t.Error("job still marked running")
+			}
+			if again := r.Run(context.Background(), job, TriggerManual); again.Outcome == OutcomeSkipped {
+				t.Error("next run skipped, the job was left locked")
+			}
+		})
+	}
+}
+
+// Проверка Running не должна мешать запускам: раньше она на миг занимала задание,
+// и плановый запуск в этот момент считался наложившимся
+func TestRunningDoesNotSkipRuns(t *testing.T) {
+	r := NewRunner(zap.NewNop(), 0, nil)
+	job := Job{Name: "totals", Fn: func(ctx context.Context) ([]ShopOutcome, error) { return nil, nil }}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					r.Running("totals")
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 5000; i++ {
+		if run := r.Run(context.Background(), job, TriggerSchedule); run.Outcome != OutcomeOK {
+			t.Fatalf("run %d outcome = %s, want %s", i, run.Outcome, OutcomeOK)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	r := NewRunner(zap.NewNop(), 3, clk)
+	ctx := context.Background()
+	run := func(name string, shops ...string) {
+		outcomes := make([]ShopOutcome, 0, len(shops))
+		for _, s := range shops {
+			outcomes = append(outcomes, ShopOutcome{Shop: s})
+		}
+		r.Run(ctx, Job{Name: name, Fn: func(ctx context.Context) ([]ShopOutcome, error) { return outcomes, nil }}, TriggerSchedule)
+		clk.Advance(time.Minute)
+	}
+
+	run("totals", "main", "second") // 10:00, вытесняется: у totals хранятся 3 запуска
+	run("items", "main")            // 10:01
+	run("totals", "main", "second") // 10:02
+	run("totals", "second")         // 10:03
+	run("snapshots")                // 10:04
+	run("totals", "main")           // 10:05
+
+	tests := []struct {
+		name  string
+		job   string
+		shop  string
+		limit int
+		want  []string // время начала, новые первыми
+		shops []int    // сколько магазинов в каждом запуске
+	}{
+		{name: "all", want: []string{"10:05", "10:04", "10:03", "10:02", "10:01"}, shops: []int{1, 0, 1, 2, 1}},
+		{name: "limit", limit: 2, want: []string{"10:05", "10:04"}, shops: []int{1, 0}},
+		{name: "job", job: "totals", want: []string{"10:05", "10:03", "10:02"}, shops: []int{1, 1, 2}},
+		{name: "shop", shop: "main", want: []string{"10:05", "10:02", "10:01"}, shops: []int{1, 1, 1}},
+		{name: "job and shop", job: "totals", shop: "second", want: []string{"10:03", "10:02"}, shops: []int{1, 1}},
+		{name: "unknown job", job: "backfill"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := r.History(tt.job, tt.shop, tt.limit)
+			if len(runs) != len(tt.want) {
+				t.Fatalf("got %d runs, want %d: %+v", len(runs), len(tt.want), runs)
+			}
+			for i, run := range runs {
+				if got := run.Started.Format("15:04"); got != tt.want[i] || len(run.Shops) != tt.shops[i] {
+					t.Errorf("run %d = %s with %d shop(s), want %s with %d", i, got, len(run.Shops), tt.want[i], tt.shops[i])
+				}
+				if tt.shop != "" && run.Shops[0].Shop != tt.shop {
+					t.Errorf("run %d has shop %s, want only %s", i, run.Shops[0].Shop, tt.shop)
+				}
+			}
+		})
+	}
+}
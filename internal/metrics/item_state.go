@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"avitoproject/internal/client/avito"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Счётчики объявления на момент выгрузки
+type itemCounters struct {
+	Impressions int
+	Views       int
+	Contacts    int
+	Spending    int
+}
+
+// Выгрузка по объявлениям магазина
+type itemSnapshot struct {
+	Day   string // день в поясе магазина, YYYY-MM-DD: счётчики Avito обнуляются в полночь
+	Taken time.Time
+	Items map[int64]itemCounters
+}
+
+const (
+	// Прирост считается к выгрузке не моложе часа. Запас на джиттер расписания:
+	// выгрузка, снятая на пару минут позже соседней, всё ещё считается часовой
+	baselineAge  = time.Hour - 5*time.Minute
+	baselineKeep = 2 * time.Hour
+)
+
+// ItemStateStore хранит выгрузки по объявлениям каждого магазина за последние часы текущего дня,
+// чтобы считать прирост за час. С непустым path состояние переживает рестарт
+type ItemStateStore struct {
+	mu    sync.Mutex
+	path  string
+	shops map[string][]itemSnapshot // ключ = имя магазина, выгрузки по возрастанию Taken
+}
+
+// path == "" — состояние только в памяти
+func NewItemStateStore(path string) (*ItemStateStore, error) {
+	s := &ItemStateStore{path: path, shops: make(map[string][]itemSnapshot)}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read item state: %w", err)
+	}
+	if err := json.Unmarshal(b, &s.shops); err != nil {
+		// файл прежнего формата: одна выгрузка на магазин
+		var last map[string]itemSnapshot
+		if json.Unmarshal(b, &last) != nil {
+			return nil, fmt.Errorf("unable to parse item state: %w", err)
+		}
+		s.shops = make(map[string][]itemSnapshot, len(last))
+		for name, snap := range last {
+			s.shops[name] = []itemSnapshot{snap}
+		}
+	}
+	return s, nil
+}
+
+// baseline — выгрузка, к которой считается прирост в момент now: последняя выгрузка дня не моложе часа.
+// Если такой нет, базой служит полночь дня в поясе магазина, когда все счётчики нулевые
+func (s *ItemStateStore) baseline(shopName string, day string, midnight time.Time, now time.Time) itemSnapshot {
+	base := itemSnapshot{Day: day, Taken: midnight}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, snap := range s.shops[shopName] {
+		if snap.Day == day && now.Sub(snap.Taken) >= baselineAge && snap.Taken.After(base.Taken) {
+			base = snap
+		}
+	}
+	return base
+}
+
+// commit запоминает выгрузку после успешной записи. Хранятся только выгрузки текущего дня
+// за последние baselineKeep и последняя из более старых, которая ещё может стать базой
+func (s *ItemStateStore) commit(shopName string, day string, taken time.Time, items []avito.ItemMetrics) error {
+	cur := itemSnapshot{Day: day, Taken: taken, Items: make(map[int64]itemCounters, len(items))}
+	for _, it := range items {
+		cur.Items[it.ID] = itemCounters{
+			Impressions: it.Impressions,
+			Views:       it.Views,
+			Contacts:    it.Contacts,
+			Spending:    it.Spending,
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []itemSnapshot
+	var older *itemSnapshot
+	for _, snap := range s.shops[shopName] {
+		if snap.Day != day {
+			continue
+		}
+		if taken.Sub(snap.Taken) > baselineKeep {
+			older = &snap
+			continue
+		}
+		kept = append(kept, snap)
+	}
+	if older != nil {
+		kept = append([]itemSnapshot{*older}, kept...)
+	}
+	s.shops[shopName] = append(kept, cur)
+	return s.save()
+}
+
+// вызывается под s.mu
+func (s *ItemStateStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(s.shops)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("unable to write item state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write item state: %w", err)
+	}
+	return nil
+}
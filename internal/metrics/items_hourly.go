@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"avitoproject/internal/client/avito"
+)
+
+// ItemHourly — строка таблицы по объявлениям: счётчики за день и прирост за последний час
+type ItemHourly struct {
+	avito.ItemMetrics
+
+	ImpressionsDiff int
+	ViewsDiff       int
+	ContactsDiff    int
+	SpendingDiff    int // в копейках
+
+	ImpressionsToViewsLastHour float64 // %, просмотры / показы за час
+	ViewsToContactsLastHour    float64 // %, контакты / просмотры за час
+	CostPerContactLastHour     float64 // в копейках
+}
+
+// hourlyRows считает прирост к базовой выгрузке магазина (см. ItemStateStore.baseline).
+// Объявление, которого не было в базе, и счётчик, который уменьшился, считаются от нуля
+func hourlyRows(items []avito.ItemMetrics, base itemSnapshot) []ItemHourly {
+	rows := make([]ItemHourly, 0, len(items))
+	for _, it := range items {
+		before := base.Items[it.ID]
+
+		row := ItemHourly{
+			ItemMetrics:     it,
+			ImpressionsDiff: diff(it.Impressions, before.Impressions),
+			ViewsDiff:       diff(it.Views, before.Views),
+			ContactsDiff:    diff(it.Contacts, before.Contacts),
+			SpendingDiff:    diff(it.Spending, before.Spending),
+		}
+		row.ImpressionsToViewsLastHour = percent(row.ViewsDiff, row.ImpressionsDiff)
+		row.ViewsToContactsLastHour = percent(row.ContactsDiff, row.ViewsDiff)
+		if row.ContactsDiff > 0 {
+			row.CostPerContactLastHour = float64(row.SpendingDiff) / float64(row.ContactsDiff)
+		}
+
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func diff(cur, prev int) int {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+func percent(part, whole int) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
@@ -0,0 +1,68 @@
+CREATE TABLE IF NOT EXISTS shops (
+    name       TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- итоговые метрики магазина за день на момент выгрузки, расход в копейках
+CREATE TABLE IF NOT EXISTS totals_snapshots (
+    shop        TEXT        NOT NULL REFERENCES shops (name),
+    bucket      TIMESTAMPTZ NOT NULL,
+    fetched_at  TIMESTAMPTZ NOT NULL,
+    spending    BIGINT      NOT NULL,
+    impressions BIGINT      NOT NULL,
+    views       BIGINT      NOT NULL,
+    contacts    BIGINT      NOT NULL,
+    PRIMARY KEY (shop, bucket)
+);
+
+-- метрики объявлений за день на момент выгрузки и прирост с предыдущей выгрузки
+CREATE TABLE IF NOT EXISTS item_metrics (
+    shop             TEXT        NOT NULL REFERENCES shops (name),
+    item_id          BIGINT      NOT NULL,
+    bucket           TIMESTAMPTZ NOT NULL,
+    fetched_at       TIMESTAMPTZ NOT NULL,
+    title            TEXT        NOT NULL,
+    url              TEXT        NOT NULL,
+    impressions      BIGINT      NOT NULL,
+    views            BIGINT      NOT NULL,
+    contacts         BIGINT      NOT NULL,
+    spending         BIGINT      NOT NULL,
+    impressions_diff BIGINT      NOT NULL,
+    views_diff       BIGINT      NOT NULL,
+    contacts_diff    BIGINT      NOT NULL,
+    spending_diff    BIGINT      NOT NULL,
+    PRIMARY KEY (shop, item_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS item_bids (
+    shop       TEXT        NOT NULL REFERENCES shops (name),
+    item_id    BIGINT      NOT NULL,
+    bucket     TIMESTAMPTZ NOT NULL,
+    bid_penny  BIGINT      NOT NULL,
+    PRIMARY KEY (shop, item_id, bucket)
+);
+
+-- снимки итоговых метрик в слоты Snapshots, день по Москве
+CREATE TABLE IF NOT EXISTS slot_snapshots (
+    shop        TEXT        NOT NULL REFERENCES shops (name),
+    day         DATE        NOT NULL,
+    slot        TEXT        NOT NULL,
+    taken_at    TIMESTAMPTZ NOT NULL,
+    spending    BIGINT      NOT NULL,
+    impressions BIGINT      NOT NULL,
+    views       BIGINT      NOT NULL,
+    contacts    BIGINT      NOT NULL,
+    PRIMARY KEY (shop, day, slot)
+);
+
+-- историческая выгрузка (backfill)
+CREATE TABLE IF NOT EXISTS period_metrics (
+    shop        TEXT   NOT NULL REFERENCES shops (name),
+    grouping    TEXT   NOT NULL,
+    period      DATE   NOT NULL,
+    spending    BIGINT NOT NULL,
+    impressions BIGINT NOT NULL,
+    views       BIGINT NOT NULL,
+    contacts    BIGINT NOT NULL,
+    PRIMARY KEY (shop, grouping, period)
+);
@@ -0,0 +1,7 @@
+-- 0001 не меняется: она уже применена на рабочих базах. Уточнения к её описаниям таблиц — здесь
+
+COMMENT ON TABLE item_metrics IS
+    'метрики объявлений за день на момент выгрузки и прирост за последний час';
+
+COMMENT ON TABLE slot_snapshots IS
+    'снимки итоговых метрик в слоты Snapshots, день в поясе магазина (Shop.Timezone или Timezone)';
@@ -1,10 +1,18 @@
 package metrics
 
 import (
+	"avitoproject/config"
 	"avitoproject/internal/client/avito"
 	"context"
 )
 
-type Repository interface {
-	UpdateGoogleSheet(ctx context.Context, shopName string, data avito.AvitoMetricsData) error
+// Sink — получатель выгруженных метрик: Google Sheets, локальная история, CSV, вебхук и т.д.
+type Sink interface {
+	// Name — имя, под которым sink включается в конфиге (Sinks, Shop.Sinks)
+	Name() string
+	SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error
+	SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error
+	// SaveSnapshot фиксирует итоговые метрики магазина для слота snap дня day ("2006-01-02" в поясе магазина)
+	SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error
+	AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error
 }
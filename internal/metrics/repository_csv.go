@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	csvTotalsHeader    = []string{"time", "shop", "spending", "impressions", "views", "contacts"}
+	csvItemsHeader     = []string{"time", "shop", "item_id", "title", "impressions", "views", "contacts", "spending", "impressions_diff", "views_diff", "contacts_diff", "spending_diff", "bid_penny"}
+	csvSnapshotsHeader = []string{"time", "shop", "slot", "spending", "impressions", "views", "contacts"}
+	csvHistoryHeader   = []string{"shop", "grouping", "period", "spending", "impressions", "views", "contacts"}
+)
+
+// RepositoryCSV дописывает выгрузки в CSV-файлы каталога: totals.csv, items.csv, snapshots.csv, history.csv.
+// Расход — в копейках, как его отдаёт Avito
+type RepositoryCSV struct {
+	logger *zap.Logger
+	dir    string
+	clock  clock.Clock
+	mu     sync.Mutex
+}
+
+// clk == nil — clock.System
+func NewRepositoryCSV(logger *zap.Logger, dir string, clk clock.Clock) (*RepositoryCSV, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create csv dir: %w", err)
+	}
+	return &RepositoryCSV{logger: logger, dir: dir, clock: clock.Or(clk)}, nil
+}
+
+func (r *RepositoryCSV) Name() string {
+	return "csv"
+}
+
+func (r *RepositoryCSV) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	return r.append("totals.csv", csvTotalsHeader, [][]string{{
+		r.clock.Now().Format(time.RFC3339),
+		shopName,
+		strconv.Itoa(data.Spending),
+		strconv.Itoa(data.Impressions),
+		strconv.Itoa(data.Views),
+		strconv.Itoa(data.Contacts),
+	}})
+}
+
+func (r *RepositoryCSV) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	now := r.clock.Now().Format(time.RFC3339)
+	rows := make([][]string, 0, len(items))
+	for _, it := range items {
+		rows = append(rows, []string{
+			now,
+			shop.Name,
+			strconv.FormatInt(it.ID, 10),
+			it.Title,
+			strconv.Itoa(it.Impressions),
+			strconv.Itoa(it.Views),
+			strconv.Itoa(it.Contacts),
+			strconv.Itoa(it.Spending),
+			strconv.Itoa(it.ImpressionsDiff),
+			strconv.Itoa(it.ViewsDiff),
+			strconv.Itoa(it.ContactsDiff),
+			strconv.Itoa(it.SpendingDiff),
+			strconv.Itoa(it.BidPenny),
+		})
+	}
+	return r.append("items.csv", csvItemsHeader, rows)
+}
+
+func (r *RepositoryCSV) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	return r.append("snapshots.csv", csvSnapshotsHeader, [][]string{{
+		r.clock.Now().Format(time.RFC3339),
+		shop.Name,
+		snap.Time,
+		strconv.Itoa(data.Spending),
+		strconv.Itoa(data.Impressions),
+		strconv.Itoa(data.Views),
+		strconv.Itoa(data.Contacts),
+	}})
+}
+
+func (r *RepositoryCSV) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	rows := make([][]string, 0, len(periods))
+	for _, p := range periods {
+		rows = append(rows, []string{
+			shopName,
+			grouping,
+			p.Period,
+			strconv.Itoa(p.Spending),
+			strconv.Itoa(p.Impressions),
+			strconv.Itoa(p.Views),
+			strconv.Itoa(p.Contacts),
+		})
+	}
+	return r.append("history.csv", csvHistoryHeader, rows)
+}
+
+// append дописывает строки в файл, для нового файла сначала пишет заголовок
+func (r *RepositoryCSV) append(name string, header []string, rows [][]string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(r.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", name, err)
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to open %s: %w", name, err)
+	}
+
+	w := csv.NewWriter(f)
+	if st.Size() == 0 {
+		_ = w.Write(header)
+	}
+	_ = w.WriteAll(rows) // WriteAll сам делает Flush
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+
+	r.logger.Debug("csv rows written", zap.String("file", name), zap.Int("rows", len(rows)))
+	return nil
+}
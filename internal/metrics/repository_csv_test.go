@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return records
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "csv")
+	clk := clock.NewFake(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	r, err := NewRepositoryCSV(zap.NewNop(), dir, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	shop := config.Shop{Name: "main"}
+
+	if err := r.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: 12345, Impressions: 1000, Views: 100, Contacts: 5}); err != nil {
+		t.Fatal(err)
+	}
+	// запятые, кавычки и переносы в названии не ломают строку
+	items := []ItemHourly{
+		{ItemMetrics: avito.ItemMetrics{ID: 42, Title: "Диван \"Лион\", угловой\nбежевый", Impressions: 10, Views: 4, Contacts: 1, Spending: 500, BidPenny: 1500},
+			ImpressionsDiff: 3, ViewsDiff: 2, ContactsDiff: 1, SpendingDiff: 150},
+		{ItemMetrics: avito.ItemMetrics{ID: 43, Title: "Стул"}},
+	}
+	if err := r.SaveItems(ctx, shop, items); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveSnapshot(ctx, shop, config.SnapshotTime{Time: "10:00"}, "2026-10-17", avito.AvitoMetricsData{Spending: 12345, Impressions: 1000, Views: 100, Contacts: 5}); err != nil {
+		t.Fatal(err)
+	}
+	periods := []avito.PeriodMetrics{
+		{Period: "2026-10-01", AvitoMetricsData: avito.AvitoMetricsData{Spending: 700, Impressions: 70, Views: 7, Contacts: 1}},
+		{Period: "2026-10-08", AvitoMetricsData: avito.AvitoMetricsData{Spending: 800, Impressions: 80, Views: 8}},
+	}
+	if err := r.AppendHistory(ctx, shop.Name, avito.GroupingWeek, periods); err != nil {
+		t.Fatal(err)
+	}
+	// пустая выгрузка не создаёт файл и не пишет заголовок
+	if err := r.AppendHistory(ctx, "other", avito.GroupingDay, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// после рестарта строки дописываются в те же файлы без второго заголовка
+	clk.Advance(time.Hour)
+	r, err = NewRepositoryCSV(zap.NewNop(), dir, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: 20000}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want [][]string
+	}{
+		{file: "totals.csv", want: [][]string{
+			csvTotalsHeader,
+			{"2026-10-17T10:00:00Z", "main", "12345", "1000", "100", "5"},
+			{"2026-10-17T11:00:00Z", "main", "20000", "0", "0", "0"},
+		}},
+		{file: "items.csv", want: [][]string{
+			csvItemsHeader,
+			{"2026-10-17T10:00:00Z", "main", "42", "Диван \"Лион\", угловой\nбежевый", "10", "4", "1", "500", "3", "2", "1", "150", "1500"},
+			{"2026-10-17T10:00:00Z", "main", "43", "Стул", "0", "0", "0", "0", "0", "0", "0", "0", "0"},
+		}},
+		{file: "snapshots.csv", want: [][]string{
+			csvSnapshotsHeader,
+			{"2026-10-17T10:00:00Z", "main", "10:00", "12345", "1000", "100", "5"},
+		}},
+		{file: "history.csv", want: [][]string{
+			csvHistoryHeader,
+			{"main", "week", "2026-10-01", "700", "70", "7", "1"},
+			{"main", "week", "2026-10-08", "800", "80", "8", "0"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := readCSV(t, filepath.Join(dir, tt.file)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
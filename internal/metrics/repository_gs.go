@@ -4,27 +4,32 @@ import (
 	"avitoproject/config"
 	"avitoproject/internal/client/avito"
 	googleClient "avitoproject/internal/client/google"
+	"avitoproject/internal/clock"
 	"context"
 	"fmt"
 	"go.uber.org/zap"
-	"time"
+	"math"
 )
 
 type RepositoryMetrics struct {
 	logger *zap.Logger
 	cfg    config.Config
-	client *googleClient.Client
+	zones  *clock.Zones
+	clock  clock.Clock
+	client googleClient.SheetsAPI
 }
 
-func NewRepositoryMetrics(logger *zap.Logger, cfg config.Config, client *googleClient.Client) *RepositoryMetrics {
+func NewRepositoryMetrics(logger *zap.Logger, cfg config.Config, zones *clock.Zones, clk clock.Clock, client googleClient.SheetsAPI) *RepositoryMetrics {
 	return &RepositoryMetrics{
 		logger: logger,
 		cfg:    cfg,
+		zones:  zones,
+		clock:  clock.Or(clk),
 		client: client,
 	}
 }
 
-func (r *RepositoryMetrics) UpdateGoogleSheet(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+func (r *RepositoryMetrics) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
 	var writeRange string
 	for _, shop := range r.cfg.Shops {
 		if shop.Name == shopName {
@@ -45,7 +50,7 @@ func (r *RepositoryMetrics) UpdateGoogleSheet(ctx context.Context, shopName stri
 	}
 
 	// вызов метода из Google клиента
-	if err := r.client.UpdateSheet(writeRange, values); err != nil {
+	if err := r.client.UpdateSheet(ctx, writeRange, values); err != nil {
 		return fmt.Errorf("unable to write data to sheet: %w", err)
 	}
 
@@ -53,35 +58,29 @@ func (r *RepositoryMetrics) UpdateGoogleSheet(ctx context.Context, shopName stri
 	return nil
 }
 
-func (r *RepositoryMetrics) SaveSnapshotsIfDue(ctx context.Context) {
-	msk := time.FixedZone("MSK", 3*3600)
-	now := time.Now().In(msk)
-	current := fmt.Sprintf("%02d:%02d", now.Hour(), now.Minute())
-
-	updates := make(map[string][][]interface{})
+func (r *RepositoryMetrics) Name() string {
+	return "sheets"
+}
 
-	for _, shop := range r.cfg.Shops {
-		for _, snap := range shop.Snapshots {
-			if snap.Time == current {
-				data, err := r.client.ReadRange(shop.SheetRange)
-				if err != nil {
-					r.logger.Error("Failed to read current range", zap.String("shop", shop.Name), zap.Error(err))
-					continue
-				}
-
-				// Транспонируем данные, чтобы строки стали колонками
-				updates[snap.Range] = transpose(data)
-			}
-		}
+// SaveSnapshot копирует текущие значения магазина из SheetRange в диапазон слота,
+// транспонируя колонку в строку. data не используется: снимок делается с того, что видно в таблице
+func (r *RepositoryMetrics) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	values, err := r.client.ReadRange(ctx, shop.SheetRange)
+	if err != nil {
+		return fmt.Errorf("unable to read current range: %w", err)
 	}
 
-	if len(updates) > 0 {
-		if err := r.client.BatchUpdate(updates); err != nil {
-			r.logger.Error("Failed to write snapshots", zap.Error(err))
-		} else {
-			r.logger.Info("Snapshots saved", zap.Any("ranges", updates))
-		}
+	// Транспонируем данные, чтобы строки стали колонками
+	if err := r.client.UpdateSheet(ctx, snap.Range, transpose(values)); err != nil {
+		return fmt.Errorf("unable to write snapshot: %w", err)
 	}
+
+	r.logger.Info("Snapshot saved", zap.String("shop", shop.Name), zap.String("slot", snap.Time), zap.String("range", snap.Range))
+	return nil
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
 }
 
 // Вспомогательная функция транспонирования
@@ -105,37 +104,110 @@ func transpose(values [][]interface{}) [][]interface{} {
 	return result
 }
 
+// ClearAllSnapshotRanges архивирует и очищает диапазоны снапшотов всех магазинов
 func (r *RepositoryMetrics) ClearAllSnapshotRanges(ctx context.Context) error {
-	updates := make(map[string][][]interface{})
+	return r.ClearSnapshotRanges(ctx, r.cfg.Shops)
+}
 
-	for _, shop := range r.cfg.Shops {
+// ClearSnapshotRanges архивирует снапшоты магазинов shops в SnapshotArchiveRange и очищает их диапазоны.
+// Если архивировать не удалось, диапазоны не очищаются. Диапазоны магазина, снапшоты которого
+// больше нигде не сохраняются (см. config.SnapshotsArchived), не очищаются никогда
+func (r *RepositoryMetrics) ClearSnapshotRanges(ctx context.Context, shops []config.Shop) error {
+	var archived []config.Shop
+	for _, shop := range shops {
+		if len(shop.Snapshots) > 0 && !r.cfg.SnapshotsArchived(shop) {
+			r.logger.Warn("Snapshot ranges are not cleared: no archive destination", zap.String("shop", shop.Name))
+			continue
+		}
+		archived = append(archived, shop)
+	}
+	shops = archived
+
+	var ranges []string
+	seen := make(map[string]bool)
+	for _, shop := range shops {
 		for _, snap := range shop.Snapshots {
-			// Полная очистка диапазона
-			updates[snap.Range] = [][]interface{}{}
+			if !seen[snap.Range] {
+				seen[snap.Range] = true
+				ranges = append(ranges, snap.Range)
+			}
 		}
 	}
 
-	if len(updates) == 0 {
+	if len(ranges) == 0 {
 		return nil
 	}
 
-	if err := r.client.BatchUpdate(updates); err != nil {
+	if r.cfg.SnapshotArchiveRange != "" {
+		if err := r.archiveSnapshots(ctx, shops, ranges); err != nil {
+			return fmt.Errorf("snapshot ranges are not cleared: %w", err)
+		}
+	}
+
+	if err := r.client.BatchClear(ctx, ranges); err != nil {
 		return fmt.Errorf("failed to clear snapshot ranges: %w", err)
 	}
 
-	r.logger.Info("All snapshot ranges cleared at 00:00")
+	r.logger.Info("Snapshot ranges cleared", zap.Int("ranges", len(ranges)))
 	return nil
 }
 
-func (r *RepositoryMetrics) UpdateGoogleSheetForItemsHourly(ctx context.Context, items []avito.ItemMetrics, shop config.Shop, logger *zap.Logger) error {
-	logger.Info("Start UpdateGoogleSheetForItemsHourly", zap.String("shop", shop.Name), zap.Int("itemsCount", len(items)))
+// archiveSnapshots дописывает непустые диапазоны снапшотов в SnapshotArchiveRange
+func (r *RepositoryMetrics) archiveSnapshots(ctx context.Context, shops []config.Shop, ranges []string) error {
+	read, err := r.client.BatchRead(ctx, ranges)
+	if err != nil {
+		return fmt.Errorf("unable to read snapshot ranges: %w", err)
+	}
+	byRange := make(map[string][][]interface{}, len(ranges))
+	for i, rng := range ranges {
+		byRange[rng] = read[i]
+	}
 
-	values := [][]interface{}{}
+	now := r.clock.Now()
+	rows := [][]interface{}{}
+	for _, shop := range shops {
+		for _, snap := range shop.Snapshots {
+			values := byRange[snap.Range]
+			if len(values) == 0 {
+				continue
+			}
+			row := []interface{}{snapshotDay(now, r.zones.Shop(shop.Name), snap.Time), shop.Name, snap.Time}
+			for _, v := range values {
+				row = append(row, v...)
+			}
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
 
-	// текущий час в MSK
-	now := time.Now().In(time.FixedZone("MSK", 3*3600))
-	hour := now.Hour()
+	if err := r.client.AppendRows(ctx, r.cfg.SnapshotArchiveRange, rows); err != nil {
+		return fmt.Errorf("unable to archive snapshots: %w", err)
+	}
+
+	r.logger.Info("Snapshots archived", zap.String("range", r.cfg.SnapshotArchiveRange), zap.Int("rows", len(rows)))
+	return nil
+}
+
+// itemColumns — число колонок строки объявления в SaveItems
+const itemColumns = 15
+
+func emptyRow(n int) []interface{} {
+	row := make([]interface{}, n)
+	for i := range row {
+		row[i] = ""
+	}
+	return row
+}
 
+// Колонки: ссылка, название, ID, показы, просмотры, контакты, расход (руб) за день,
+// конверсии показ→просмотр и просмотр→контакт (%) за час, цена контакта (руб) за час,
+// прирост за час: показы, просмотры, контакты, расход (руб); ставка (коп)
+func (r *RepositoryMetrics) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	r.logger.Info("Start SaveItems", zap.String("shop", shop.Name), zap.Int("itemsCount", len(items)))
+
+	values := [][]interface{}{}
 	for _, it := range items {
 		row := []interface{}{
 			it.Link,
@@ -145,20 +217,66 @@ func (r *RepositoryMetrics) UpdateGoogleSheetForItemsHourly(ctx context.Context,
 			it.Views,
 			it.Contacts,
 			it.Spending / 100,
-			0, 0, // conversion metrics пока 0
-			it.CostPerContactLastHour,
-			0, 0, 0, // diffs
+			round2(it.ImpressionsToViewsLastHour),
+			round2(it.ViewsToContactsLastHour),
+			round2(it.CostPerContactLastHour / 100),
+			it.ImpressionsDiff,
+			it.ViewsDiff,
+			it.ContactsDiff,
+			it.SpendingDiff / 100,
 			it.BidPenny,
 		}
 		values = append(values, row)
-		logger.Debug("Prepared row for sheet", zap.Int64("itemID", it.ID), zap.Int("hour", hour))
 	}
 
-	if err := r.client.UpdateSheet(shop.SheetRange, values); err != nil {
-		logger.Error("Failed to update Google Sheet", zap.String("range", shop.SheetRange), zap.Error(err))
+	// объявления, снятые с публикации, не должны остаться в таблице: строки сверх нового списка
+	// затираются пустыми значениями в той же записи, чтобы при ошибке не остаться с пустым диапазоном
+	current, err := r.client.ReadRange(ctx, shop.ItemsSheetRange)
+	if err != nil {
+		return fmt.Errorf("unable to read items range: %w", err)
+	}
+	for len(values) < len(current) {
+		values = append(values, emptyRow(itemColumns))
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if err := r.client.UpdateSheet(ctx, shop.ItemsSheetRange, values); err != nil {
+		r.logger.Error("Failed to update Google Sheet", zap.String("range", shop.ItemsSheetRange), zap.Error(err))
 		return err
 	}
 
-	logger.Info("Google Sheet updated successfully", zap.String("range", shop.SheetRange), zap.Int("rowsWritten", len(values)))
+	r.logger.Info("Google Sheet updated successfully", zap.String("range", shop.ItemsSheetRange), zap.Int("rowsWritten", len(values)))
+	return nil
+}
+
+// AppendHistory дописывает метрики исторической выгрузки в общую таблицу HistoryRange
+func (r *RepositoryMetrics) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	if r.cfg.HistoryRange == "" {
+		return fmt.Errorf("history range is not configured")
+	}
+
+	values := [][]interface{}{}
+	for _, p := range periods {
+		values = append(values, []interface{}{
+			shopName,
+			grouping,
+			p.Period,
+			p.Spending / 100,
+			p.Impressions,
+			p.Views,
+			p.Contacts,
+		})
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if err := r.client.AppendRows(ctx, r.cfg.HistoryRange, values); err != nil {
+		return fmt.Errorf("unable to write history: %w", err)
+	}
+
+	r.logger.Info("history appended", zap.String("shop", shopName), zap.String("grouping", grouping), zap.Int("rows", len(values)))
 	return nil
 }
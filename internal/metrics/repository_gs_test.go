@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/client/google/sheetsfake"
+	"avitoproject/internal/clock"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestRepo(t *testing.T, cfg config.Config, clk clock.Clock) (*RepositoryMetrics, *sheetsfake.Sheets) {
+	t.Helper()
+	zones, err := cfg.Zones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets := sheetsfake.New()
+	return NewRepositoryMetrics(zap.NewNop(), cfg, zones, clk, sheets), sheets
+}
+
+func itemRow(id int64, title string) ItemHourly {
+	return ItemHourly{ItemMetrics: avito.ItemMetrics{ID: id, Title: title, Impressions: 10}}
+}
+
+func TestSaveItemsRemovesStaleRows(t *testing.T) {
+	shop := config.Shop{Name: "main", ItemsSheetRange: "Items!A2:O"}
+	repo, sheets := newTestRepo(t, config.Config{Shops: []config.Shop{shop}}, clock.NewFake(time.Now()))
+	ctx := context.Background()
+
+	steps := []struct {
+		name  string
+		items []ItemHourly
+		want  []string // названия в колонке B по порядку
+	}{
+		{name: "three items", items: []ItemHourly{itemRow(1, "Sofa"), itemRow(2, "Chair"), itemRow(3, "Table")}, want: []string{"Sofa", "Chair", "Table"}},
+		{name: "one removed", items: []ItemHourly{itemRow(1, "Sofa"), itemRow(3, "Table")}, want: []string{"Sofa", "Table"}},
+		{name: "all removed", items: nil, want: nil},
+		{name: "back again", items: []ItemHourly{itemRow(4, "Lamp")}, want: []string{"Lamp"}},
+	}
+	for _, step := range steps {
+		if err := repo.SaveItems(ctx, shop, step.items); err != nil {
+			t.Fatalf("%s: SaveItems: %v", step.name, err)
+		}
+		got, err := sheets.ReadRange(ctx, "Items!B2:B")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, row := range got {
+			titles = append(titles, row[0].(string))
+		}
+		if len(titles) != len(step.want) {
+			t.Fatalf("%s: titles = %v, want %v", step.name, titles, step.want)
+		}
+		for i := range titles {
+			if titles[i] != step.want[i] {
+				t.Errorf("%s: row %d = %q, want %q", step.name, i, titles[i], step.want[i])
+			}
+		}
+		// строка под последним объявлением пуста во всех колонках
+		if rest, _ := sheets.ReadRange(ctx, "Items!A"+strconv.Itoa(len(step.want)+2)+":O"); len(rest) != 0 {
+			t.Errorf("%s: stale cells below the list: %v", step.name, rest)
+		}
+	}
+}
+
+func TestClearSnapshotRangesNeedsArchive(t *testing.T) {
+	shop := config.Shop{Name: "main", Snapshots: []config.SnapshotTime{{Time: "10:00", Range: "Snapshots!B2:E2"}}}
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		wantClear bool
+	}{
+		{name: "no archive", cfg: config.Config{}, wantClear: false},
+		{name: "archive range", cfg: config.Config{SnapshotArchiveRange: "Archive!A2:G"}, wantClear: true},
+		{name: "history sink", cfg: config.Config{Sinks: []string{"sheets", "history"}, HistoryDir: t.TempDir()}, wantClear: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Shops = []config.Shop{shop}
+			repo, sheets := newTestRepo(t, tt.cfg, clock.NewFake(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)))
+			ctx := context.Background()
+			if err := sheets.UpdateSheet(ctx, "Snapshots!B2:E2", [][]interface{}{{1, 2, 3, 4}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := repo.ClearAllSnapshotRanges(ctx); err != nil {
+				t.Fatalf("ClearAllSnapshotRanges: %v", err)
+			}
+			got, _ := sheets.ReadRange(ctx, "Snapshots!B2:E2")
+			if cleared := len(got) == 0; cleared != tt.wantClear {
+				t.Errorf("cleared = %v, want %v", cleared, tt.wantClear)
+			}
+		})
+	}
+}
+
+// Очистка в полночь архивирует снапшоты прошедшего дня, а не наступившего
+func TestMidnightClearArchivesPreviousDay(t *testing.T) {
+	shop := config.Shop{Name: "main", Timezone: "Asia/Vladivostok", Snapshots: []config.SnapshotTime{{Time: "10:00", Range: "Snapshots!B2:E2"}}}
+	cfg := config.Config{Shops: []config.Shop{shop}, SnapshotArchiveRange: "Archive!A:G"}
+	// полночь 18 октября во Владивостоке — 14:00 17 октября UTC
+	clk := clock.NewFake(time.Date(2026, 10, 17, 14, 0, 0, 0, time.UTC))
+	repo, sheets := newTestRepo(t, cfg, clk)
+	ctx := context.Background()
+	if err := sheets.UpdateSheet(ctx, "Snapshots!B2:E2", [][]interface{}{{"50", "100", "10", "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.ClearSnapshotRanges(ctx, cfg.Shops); err != nil {
+		t.Fatalf("ClearSnapshotRanges: %v", err)
+	}
+	archive, _ := sheets.ReadRange(ctx, "Archive!A:G")
+	if len(archive) != 1 || archive[0][0] != "2026-10-17" || archive[0][1] != "main" || archive[0][2] != "10:00" {
+		t.Errorf("archive = %v, want one row for 2026-10-17 main 10:00", archive)
+	}
+	if rest, _ := sheets.ReadRange(ctx, "Snapshots!B2:E2"); len(rest) != 0 {
+		t.Errorf("snapshot range not cleared: %v", rest)
+	}
+}
@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	HistoryTotals   = "totals"   // итоговые метрики магазина за день на момент выгрузки
+	HistoryItem     = "item"     // метрики объявления за день на момент выгрузки
+	HistoryPeriod   = "period"   // метрики магазина за период исторической выгрузки
+	HistorySnapshot = "snapshot" // итоговые метрики магазина на момент слота снапшота
+)
+
+// HistoryRecord — одна точка истории
+type HistoryRecord struct {
+	Time     time.Time
+	Shop     string
+	Kind     string
+	ItemID   int64  `json:",omitempty"`
+	Grouping string `json:",omitempty"` // для HistoryPeriod: day, week или month
+	Slot     string `json:",omitempty"` // для HistorySnapshot: время слота, HH:MM
+
+	Impressions int
+	Views       int
+	Contacts    int
+	Spending    int // в копейках
+	BidPenny    int `json:",omitempty"`
+}
+
+// RepositoryHistory — локальная история всех выгрузок в файлах JSON Lines:
+// <dir>/<магазин>/<YYYY-MM-DD>.jsonl, один файл на магазин и день (UTC)
+type RepositoryHistory struct {
+	logger *zap.Logger
+	dir    string
+	clock  clock.Clock
+	mu     sync.Mutex
+}
+
+// clk == nil — clock.System
+func NewRepositoryHistory(logger *zap.Logger, dir string, clk clock.Clock) (*RepositoryHistory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create history dir: %w", err)
+	}
+	return &RepositoryHistory{logger: logger, dir: dir, clock: clock.Or(clk)}, nil
+}
+
+func (r *RepositoryHistory) Name() string {
+	return "history"
+}
+
+func (r *RepositoryHistory) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	return r.append([]HistoryRecord{{
+		Time:        r.clock.Now(),
+		Shop:        shopName,
+		Kind:        HistoryTotals,
+		Impressions: data.Impressions,
+		Views:       data.Views,
+		Contacts:    data.Contacts,
+		Spending:    data.Spending,
+	}})
+}
+
+func (r *RepositoryHistory) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	now := r.clock.Now()
+	records := make([]HistoryRecord, 0, len(items))
+	for _, it := range items {
+		records = append(records, HistoryRecord{
+			Time:        now,
+			Shop:        shop.Name,
+			Kind:        HistoryItem,
+			ItemID:      it.ID,
+			Impressions: it.Impressions,
+			Views:       it.Views,
+			Contacts:    it.Contacts,
+			Spending:    it.Spending,
+			BidPenny:    it.BidPenny,
+		})
+	}
+	return r.append(records)
+}
+
+func (r *RepositoryHistory) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	return r.append([]HistoryRecord{{
+		Time:        r.clock.Now(),
+		Shop:        shop.Name,
+		Kind:        HistorySnapshot,
+		Slot:        snap.Time,
+		Impressions: data.Impressions,
+		Views:       data.Views,
+		Contacts:    data.Contacts,
+		Spending:    data.Spending,
+	}})
+}
+
+func (r *RepositoryHistory) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	records := make([]HistoryRecord, 0, len(periods))
+	for _, p := range periods {
+		start, err := time.Parse("2006-01-02", p.Period)
+		if err != nil {
+			return fmt.Errorf("invalid period %q: %w", p.Period, err)
+		}
+		records = append(records, HistoryRecord{
+			Time:        start,
+			Shop:        shopName,
+			Kind:        HistoryPeriod,
+			Grouping:    grouping,
+			Impressions: p.Impressions,
+			Views:       p.Views,
+			Contacts:    p.Contacts,
+			Spending:    p.Spending,
+		})
+	}
+	return r.append(records)
+}
+
+// Query возвращает записи магазина вида kind за [from, to], отсортированные по времени.
+// itemID == 0 — все объявления
+func (r *RepositoryHistory) Query(shopName, kind string, itemID int64, from, to time.Time) ([]HistoryRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []HistoryRecord
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		records, err := r.readDay(shopName, day)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			if rec.Kind != kind || rec.Time.Before(from) || rec.Time.After(to) {
+				continue
+			}
+			if itemID != 0 && rec.ItemID != itemID {
+				continue
+			}
+			result = append(result, rec)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, nil
+}
+
+func (r *RepositoryHistory) append(records []HistoryRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// записи группируются по файлам, чтобы открыть каждый файл один раз
+	files := make(map[string][]HistoryRecord)
+	for _, rec := range records {
+		path := r.dayPath(rec.Shop, rec.Time)
+		files[path] = append(files[path], rec)
+	}
+
+	for path, recs := range files {
+		if err := writeRecords(path, recs); err != nil {
+			return fmt.Errorf("unable to write history: %w", err)
+		}
+	}
+
+	r.logger.Debug("history records written", zap.String("shop", records[0].Shop), zap.String("kind", records[0].Kind), zap.Int("records", len(records)))
+	return nil
+}
+
+func writeRecords(path string, records []HistoryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *RepositoryHistory) readDay(shopName string, day time.Time) ([]HistoryRecord, error) {
+	f, err := os.Open(r.dayPath(shopName, day))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history: %w", err)
+	}
+	defer f.Close()
+
+	var records []HistoryRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var rec HistoryRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// недописанная строка после аварийного завершения не должна ломать чтение остальных
+			r.logger.Warn("skipping corrupted history record", zap.String("file", f.Name()), zap.Error(err))
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read history: %w", err)
+	}
+	return records, nil
+}
+
+func (r *RepositoryHistory) dayPath(shopName string, t time.Time) string {
+	return filepath.Join(r.dir, url.PathEscape(shopName), t.UTC().Format("2006-01-02")+".jsonl")
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 19, 0, 0, 0, time.UTC))
+	r, err := NewRepositoryHistory(zap.NewNop(), dir, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	shop := config.Shop{Name: "main"}
+
+	// итоги каждые 2 часа с 19:00 17 октября до 03:00 18 октября UTC — в двух файлах дней;
+	// объявления 1 и 2 — вместе с ними
+	for i := 0; i < 5; i++ {
+		if err := r.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: 100 * (i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+		items := []ItemHourly{
+			{ItemMetrics: avito.ItemMetrics{ID: 1, Impressions: 10 * (i + 1)}},
+			{ItemMetrics: avito.ItemMetrics{ID: 2, Impressions: 20 * (i + 1)}},
+		}
+		if err := r.SaveItems(ctx, shop, items); err != nil {
+			t.Fatal(err)
+		}
+		clk.Advance(2 * time.Hour)
+	}
+	if err := r.SaveTotals(ctx, "other", avito.AvitoMetricsData{Spending: 999}); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []string{"2026-10-17", "2026-10-18"} {
+		if _, err := os.Stat(filepath.Join(dir, "main", day+".jsonl")); err != nil {
+			t.Fatalf("day file %s: %v", day, err)
+		}
+	}
+
+	at := func(hour int) time.Time { return time.Date(2026, 10, 17, hour, 0, 0, 0, time.UTC) }
+	msk, _ := clock.Load("Europe/Moscow")
+	tests := []struct {
+		name   string
+		shop   string
+		kind   string
+		itemID int64
+		from   time.Time
+		to     time.Time
+		want   []int // расход итогов или показы объявлений по порядку
+	}{
+		{name: "across day files", kind: HistoryTotals, from: at(0), to: at(48), want: []int{100, 200, 300, 400, 500}},
+		{name: "bounds are inclusive", kind: HistoryTotals, from: at(21), to: at(25), want: []int{200, 300, 400}},
+		{name: "just outside bounds", kind: HistoryTotals, from: at(21).Add(time.Second), to: at(25).Add(-time.Second), want: []int{300}},
+		{name: "single instant", kind: HistoryTotals, from: at(23), to: at(23), want: []int{300}},
+		{name: "bounds in another zone", kind: HistoryTotals, from: at(21).In(msk), to: at(23).In(msk), want: []int{200, 300}},
+		{name: "all items", kind: HistoryItem, from: at(19), to: at(21), want: []int{10, 20, 20, 40}},
+		{name: "one item", kind: HistoryItem, itemID: 2, from: at(0), to: at(48), want: []int{20, 40, 60, 80, 100}},
+		{name: "unknown item", kind: HistoryItem, itemID: 3, from: at(0), to: at(48)},
+		{name: "other kind", kind: HistorySnapshot, from: at(0), to: at(48)},
+		{name: "other shop", shop: "other", kind: HistoryTotals, from: at(0), to: at(48), want: []int{999}},
+		{name: "empty range", kind: HistoryTotals, from: at(25), to: at(21)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopName := tt.shop
+			if shopName == "" {
+				shopName = shop.Name
+			}
+			records, err := r.Query(shopName, tt.kind, tt.itemID, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int, 0, len(records))
+			for _, rec := range records {
+				if tt.kind == HistoryItem {
+					got = append(got, rec.Impressions)
+				} else {
+					got = append(got, rec.Spending)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryQuerySkipsCorruptedLines(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	r, err := NewRepositoryHistory(zap.NewNop(), dir, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := r.SaveTotals(ctx, "main", avito.AvitoMetricsData{Spending: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// процесс упал посреди записи: строка оборвана
+	path := filepath.Join(dir, "main", "2026-10-17.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"Time":"2026-10-17T10:30:00Z","Shop":"main","Kind":"tot` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	clk.Advance(time.Hour)
+	if err := r.SaveTotals(ctx, "main", avito.AvitoMetricsData{Spending: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := r.Query("main", HistoryTotals, 0, clk.Now().Add(-24*time.Hour), clk.Now())
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(records) != 2 || records[0].Spending != 100 || records[1].Spending != 200 {
+		t.Errorf("records = %+v, want spending 100 and 200 around the corrupted line", records)
+	}
+}
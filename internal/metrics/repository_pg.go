@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const defaultPostgresBucket = 10 * time.Minute
+
+// ключ advisory lock на время миграций
+const migrationLockKey = 7420315
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// RepositoryPostgres хранит все выгрузки в PostgreSQL для BI.
+// Записи с одинаковыми магазином, объявлением и интервалом bucket перезаписываются,
+// поэтому повторный запуск за тот же интервал не создаёт дублей
+type RepositoryPostgres struct {
+	logger *zap.Logger
+	pool   *pgxpool.Pool
+	bucket time.Duration
+	zones  *clock.Zones
+	clock  clock.Clock
+}
+
+// NewRepositoryPostgres подключается к базе и применяет миграции. bucket <= 0 — 10 минут, clk == nil — clock.System
+func NewRepositoryPostgres(ctx context.Context, logger *zap.Logger, dsn string, bucket time.Duration, zones *clock.Zones, clk clock.Clock) (*RepositoryPostgres, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to postgres: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to connect to postgres: %w", err)
+	}
+
+	if bucket <= 0 {
+		bucket = defaultPostgresBucket
+	}
+	r := &RepositoryPostgres{logger: logger, pool: pool, bucket: bucket, zones: zones, clock: clock.Or(clk)}
+
+	if err := r.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RepositoryPostgres) Close() {
+	r.pool.Close()
+}
+
+func (r *RepositoryPostgres) Name() string {
+	return "postgres"
+}
+
+func (r *RepositoryPostgres) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	now := r.clock.Now()
+	b := &pgx.Batch{}
+	queueShop(b, shopName)
+	b.Queue(`
+		INSERT INTO totals_snapshots (shop, bucket, fetched_at, spending, impressions, views, contacts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (shop, bucket) DO UPDATE SET
+			fetched_at = EXCLUDED.fetched_at,
+			spending = EXCLUDED.spending,
+			impressions = EXCLUDED.impressions,
+			views = EXCLUDED.views,
+			contacts = EXCLUDED.contacts`,
+		shopName, now.Truncate(r.bucket), now, data.Spending, data.Impressions, data.Views, data.Contacts)
+
+	return r.sendBatch(ctx, b)
+}
+
+func (r *RepositoryPostgres) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	now := r.clock.Now()
+	bucket := now.Truncate(r.bucket)
+
+	b := &pgx.Batch{}
+	queueShop(b, shop.Name)
+	for _, it := range items {
+		b.Queue(`
+			INSERT INTO item_metrics (shop, item_id, bucket, fetched_at, title, url,
+				impressions, views, contacts, spending,
+				impressions_diff, views_diff, contacts_diff, spending_diff)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			ON CONFLICT (shop, item_id, bucket) DO UPDATE SET
+				fetched_at = EXCLUDED.fetched_at,
+				title = EXCLUDED.title,
+				url = EXCLUDED.url,
+				impressions = EXCLUDED.impressions,
+				views = EXCLUDED.views,
+				contacts = EXCLUDED.contacts,
+				spending = EXCLUDED.spending,
+				impressions_diff = EXCLUDED.impressions_diff,
+				views_diff = EXCLUDED.views_diff,
+				contacts_diff = EXCLUDED.contacts_diff,
+				spending_diff = EXCLUDED.spending_diff`,
+			shop.Name, it.ID, bucket, now, it.Title, it.Link,
+			it.Impressions, it.Views, it.Contacts, it.Spending,
+			it.ImpressionsDiff, it.ViewsDiff, it.ContactsDiff, it.SpendingDiff)
+		b.Queue(`
+			INSERT INTO item_bids (shop, item_id, bucket, bid_penny)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (shop, item_id, bucket) DO UPDATE SET bid_penny = EXCLUDED.bid_penny`,
+			shop.Name, it.ID, bucket, it.BidPenny)
+	}
+
+	return r.sendBatch(ctx, b)
+}
+
+func (r *RepositoryPostgres) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	now := r.clock.Now()
+	b := &pgx.Batch{}
+	queueShop(b, shop.Name)
+	b.Queue(`
+		INSERT INTO slot_snapshots (shop, day, slot, taken_at, spending, impressions, views, contacts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (shop, day, slot) DO UPDATE SET
+			taken_at = EXCLUDED.taken_at,
+			spending = EXCLUDED.spending,
+			impressions = EXCLUDED.impressions,
+			views = EXCLUDED.views,
+			contacts = EXCLUDED.contacts`,
+		shop.Name, day, snap.Time, now, data.Spending, data.Impressions, data.Views, data.Contacts)
+
+	return r.sendBatch(ctx, b)
+}
+
+func (r *RepositoryPostgres) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	b := &pgx.Batch{}
+	queueShop(b, shopName)
+	for _, p := range periods {
+		b.Queue(`
+			INSERT INTO period_metrics (shop, grouping, period, spending, impressions, views, contacts)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (shop, grouping, period) DO UPDATE SET
+				spending = EXCLUDED.spending,
+				impressions = EXCLUDED.impressions,
+				views = EXCLUDED.views,
+				contacts = EXCLUDED.contacts`,
+			shopName, grouping, p.Period, p.Spending, p.Impressions, p.Views, p.Contacts)
+	}
+
+	return r.sendBatch(ctx, b)
+}
+
+func queueShop(b *pgx.Batch, shopName string) {
+	b.Queue(`INSERT INTO shops (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, shopName)
+}
+
+// sendBatch выполняет батч в одной транзакции: либо записывается всё, либо ничего
+func (r *RepositoryPostgres) sendBatch(ctx context.Context, b *pgx.Batch) error {
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, b).Close()
+	})
+	if err != nil {
+		return fmt.Errorf("postgres write failed: %w", err)
+	}
+	return nil
+}
+
+// migrate применяет ещё не применённые файлы из migrations/ по возрастанию номера.
+// Advisory lock не даёт двум процессам мигрировать одновременно
+func (r *RepositoryPostgres) migrate(ctx context.Context) error {
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("unable to lock migrations: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version    INT PRIMARY KEY,
+				applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`); err != nil {
+			return fmt.Errorf("unable to create schema_migrations: %w", err)
+		}
+
+		for _, f := range files {
+			version, err := strconv.Atoi(strings.SplitN(f.Name(), "_", 2)[0])
+			if err != nil {
+				return fmt.Errorf("invalid migration name %s", f.Name())
+			}
+
+			var applied bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+				return err
+			}
+			if applied {
+				continue
+			}
+
+			sql, err := migrations.ReadFile(path.Join("migrations", f.Name()))
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return fmt.Errorf("migration %s failed: %w", f.Name(), err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+				return err
+			}
+			r.logger.Info("postgres migration applied", zap.String("file", f.Name()))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// pgTestDsn — DSN отдельной схемы в базе из AVITO_TEST_PG_DSN, схема удаляется после теста
+func pgTestDsn(t *testing.T) (string, *pgxpool.Pool) {
+	t.Helper()
+	dsn := os.Getenv("AVITO_TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("AVITO_TEST_PG_DSN is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("avito_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	switch {
+	case !strings.Contains(dsn, "://"):
+		dsn += " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		dsn += "&search_path=" + schema
+	default:
+		dsn += "?search_path=" + schema
+	}
+	return dsn, admin
+}
+
+func newTestPostgres(t *testing.T, dsn string) *RepositoryPostgres {
+	t.Helper()
+	zones, _ := clock.NewZones("UTC", nil)
+	r, err := NewRepositoryPostgres(context.Background(), zap.NewNop(), dsn, 0, zones, nil)
+	if err != nil {
+		t.Fatalf("NewRepositoryPostgres: %v", err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestPostgresMigrationsApplyOnce(t *testing.T) {
+	dsn, _ := pgTestDsn(t)
+	ctx := context.Background()
+
+	// второй запуск на той же схеме ничего не применяет повторно
+	newTestPostgres(t, dsn)
+	r := newTestPostgres(t, dsn)
+
+	files, _ := migrations.ReadDir("migrations")
+	var applied int
+	if err := r.pool.QueryRow(ctx, `SELECT count(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(files) {
+		t.Errorf("schema_migrations has %d rows, want %d", applied, len(files))
+	}
+	for _, table := range []string{"shops", "totals_snapshots", "item_metrics", "item_bids", "slot_snapshots", "period_metrics"} {
+		var exists bool
+		if err := r.pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+}
+
+func TestPostgresMigrationWaitsForLock(t *testing.T) {
+	dsn, admin := pgTestDsn(t)
+	ctx := context.Background()
+
+	// другой процесс держит блокировку миграций
+	tx, err := admin.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		r, err := NewRepositoryPostgres(ctx, zap.NewNop(), dsn, 0, nil, nil)
+		if err == nil {
+			r.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("migration finished while the lock was held: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("migration after the lock was released: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("migration did not finish after the lock was released")
+	}
+}
+
+func TestPostgresSaveSnapshotIsIdempotent(t *testing.T) {
+	dsn, _ := pgTestDsn(t)
+	r := newTestPostgres(t, dsn)
+	ctx := context.Background()
+	shop := config.Shop{Name: "main"}
+	snap := config.SnapshotTime{Time: "00:00"}
+
+	for _, data := range []avito.AvitoMetricsData{{Spending: 100, Impressions: 10}, {Spending: 250, Impressions: 30}} {
+		if err := r.SaveSnapshot(ctx, shop, snap, "2026-10-17", data); err != nil {
+			t.Fatalf("SaveSnapshot: %v", err)
+		}
+	}
+
+	var rows, spending, impressions int
+	err := r.pool.QueryRow(ctx, `SELECT count(*), max(spending), max(impressions) FROM slot_snapshots WHERE shop = $1 AND slot = $2`,
+		shop.Name, snap.Time).Scan(&rows, &spending, &impressions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 || spending != 250 || impressions != 30 {
+		t.Errorf("slot_snapshots: %d row(s), spending %d, impressions %d; want one row with the last values 250 and 30", rows, spending, impressions)
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// Тело запроса вебхука
+type WebhookEvent struct {
+	Type     string                  `json:"type"` // totals, items, snapshot, history
+	Shop     string                  `json:"shop"`
+	Time     time.Time               `json:"time"`
+	Slot     string                  `json:"slot,omitempty"`
+	Grouping string                  `json:"grouping,omitempty"`
+	Totals   *avito.AvitoMetricsData `json:"totals,omitempty"`
+	Items    []ItemHourly            `json:"items,omitempty"`
+	Periods  []avito.PeriodMetrics   `json:"periods,omitempty"`
+}
+
+// RepositoryWebhook отправляет каждую выгрузку POST-запросом с JSON на заданный URL
+type RepositoryWebhook struct {
+	logger  *zap.Logger
+	url     string
+	http    *http.Client
+	timeout time.Duration
+	clock   clock.Clock
+}
+
+// timeout <= 0 — 10 секунд, clk == nil — clock.System
+func NewRepositoryWebhook(logger *zap.Logger, url string, timeout time.Duration, clk clock.Clock) *RepositoryWebhook {
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &RepositoryWebhook{
+		logger:  logger,
+		url:     url,
+		http:    &http.Client{},
+		timeout: timeout,
+		clock:   clock.Or(clk),
+	}
+}
+
+func (r *RepositoryWebhook) Name() string {
+	return "webhook"
+}
+
+func (r *RepositoryWebhook) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	return r.post(ctx, WebhookEvent{Type: "totals", Shop: shopName, Time: r.clock.Now(), Totals: &data})
+}
+
+func (r *RepositoryWebhook) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	return r.post(ctx, WebhookEvent{Type: "items", Shop: shop.Name, Time: r.clock.Now(), Items: items})
+}
+
+func (r *RepositoryWebhook) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	return r.post(ctx, WebhookEvent{Type: "snapshot", Shop: shop.Name, Time: r.clock.Now(), Slot: snap.Time, Totals: &data})
+}
+
+func (r *RepositoryWebhook) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	return r.post(ctx, WebhookEvent{Type: "history", Shop: shopName, Time: r.clock.Now(), Grouping: grouping, Periods: periods})
+}
+
+func (r *RepositoryWebhook) post(ctx context.Context, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook bad status: %s", resp.Status)
+	}
+
+	r.logger.Debug("webhook delivered", zap.String("type", event.Type), zap.String("shop", event.Shop))
+	return nil
+}
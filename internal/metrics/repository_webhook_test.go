@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// webhookReceiver — httptest-сервер, который запоминает принятые события и отвечает status
+type webhookReceiver struct {
+	mu     sync.Mutex
+	events []WebhookEvent
+	status int
+}
+
+func newWebhookReceiver(t *testing.T, status int) (*webhookReceiver, string) {
+	t.Helper()
+	rec := &webhookReceiver{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with Content-Type %q, want POST with application/json", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("body is not a WebhookEvent: %v\n%s", err, body)
+		}
+		rec.mu.Lock()
+		rec.events = append(rec.events, event)
+		rec.mu.Unlock()
+		w.WriteHeader(rec.status)
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv.URL
+}
+
+func (rec *webhookReceiver) received() []WebhookEvent {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.events
+}
+
+func TestWebhookPayload(t *testing.T) {
+	rec, url := newWebhookReceiver(t, http.StatusOK)
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	r := NewRepositoryWebhook(zap.NewNop(), url, 0, clock.NewFake(now))
+	ctx := context.Background()
+	shop := config.Shop{Name: "main"}
+	totals := avito.AvitoMetricsData{Spending: 12345, Impressions: 1000, Views: 100, Contacts: 5}
+	items := []ItemHourly{{ItemMetrics: avito.ItemMetrics{ID: 42, Title: "Sofa", Impressions: 10}, ImpressionsDiff: 3}}
+	periods := []avito.PeriodMetrics{{Period: "2026-10-01", AvitoMetricsData: totals}}
+
+	if err := r.SaveTotals(ctx, shop.Name, totals); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveItems(ctx, shop, items); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveSnapshot(ctx, shop, config.SnapshotTime{Time: "10:00"}, "2026-10-17", totals); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AppendHistory(ctx, shop.Name, avito.GroupingWeek, periods); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []WebhookEvent{
+		{Type: "totals", Shop: "main", Time: now, Totals: &totals},
+		{Type: "items", Shop: "main", Time: now, Items: items},
+		{Type: "snapshot", Shop: "main", Time: now, Slot: "10:00", Totals: &totals},
+		{Type: "history", Shop: "main", Time: now, Grouping: avito.GroupingWeek, Periods: periods},
+	}
+	if got := rec.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr string
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusAccepted},
+		{status: http.StatusNoContent},
+		{status: http.StatusNotModified, wantErr: "webhook bad status: 304 Not Modified"},
+		{status: http.StatusBadRequest, wantErr: "webhook bad status: 400 Bad Request"},
+		{status: http.StatusTooManyRequests, wantErr: "webhook bad status: 429 Too Many Requests"},
+		{status: http.StatusBadGateway, wantErr: "webhook bad status: 502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			rec, url := newWebhookReceiver(t, tt.status)
+			r := NewRepositoryWebhook(zap.NewNop(), url, 0, nil)
+			err := r.SaveTotals(context.Background(), "main", avito.AvitoMetricsData{Spending: 100})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("SaveTotals: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			// без повторов: один запрос на выгрузку
+			if n := len(rec.received()); n != 1 {
+				t.Errorf("webhook received %d requests, want 1", n)
+			}
+		})
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	r := NewRepositoryWebhook(zap.NewNop(), srv.URL, 50*time.Millisecond, nil)
+	err := r.SaveTotals(context.Background(), "main", avito.AvitoMetricsData{})
+	if err == nil || !strings.HasPrefix(err.Error(), "webhook request failed") {
+		t.Errorf("err = %v, want a request timeout", err)
+	}
+
+	// недоступный адрес — тоже ошибка запроса, а не паника или зависание
+	srv.Close()
+	if err := r.SaveTotals(context.Background(), "main", avito.AvitoMetricsData{}); err == nil {
+		t.Error("SaveTotals to a closed server succeeded")
+	}
+}
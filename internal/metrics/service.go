@@ -1,31 +1,243 @@
 package metrics
 
 import (
+	"avitoproject/config"
 	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
 	"context"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"slices"
+	"sync"
+	"time"
 )
 
+const defaultSnapshotGrace = 30 * time.Minute
+
+// JobSnapshots — задача снятия снапшотов. Под этим именем её запускают и расписание, и admin API,
+// поэтому ручной запуск не накладывается на плановый
+const JobSnapshots = "snapshots"
+
+var errNoTotals = errors.New("no totals fetched yet")
+
 type ServiceMetrics struct {
-	logger     *zap.Logger
-	repository Repository
+	logger    *zap.Logger
+	cfg       config.Config
+	zones     *clock.Zones
+	clock     clock.Clock
+	sink      Sink
+	itemState *ItemStateStore
+	snapState *SnapshotStateStore
+
+	mu     sync.Mutex
+	latest map[string]avito.AvitoMetricsData // последние итоговые метрики по имени магазина, для снапшотов
 }
 
-func NewServiceMetrics(logger *zap.Logger, repository Repository) *ServiceMetrics {
+func NewServiceMetrics(logger *zap.Logger, cfg config.Config, zones *clock.Zones, clk clock.Clock, sink Sink, itemState *ItemStateStore, snapState *SnapshotStateStore) *ServiceMetrics {
 	return &ServiceMetrics{
-		logger:     logger,
-		repository: repository,
+		logger:    logger,
+		cfg:       cfg,
+		zones:     zones,
+		clock:     clock.Or(clk),
+		sink:      sink,
+		itemState: itemState,
+		snapState: snapState,
+		latest:    make(map[string]avito.AvitoMetricsData),
+	}
+}
+
+func (s *ServiceMetrics) SaveTotals(ctx context.Context, shopName string, metrics avito.AvitoMetricsData) error {
+	s.logger.Debug("saving totals", zap.String("service", "metrics"), zap.String("shop", shopName))
+
+	s.mu.Lock()
+	s.latest[shopName] = metrics
+	s.mu.Unlock()
+
+	if err := s.sink.SaveTotals(ctx, shopName, metrics); err != nil {
+		s.logger.Error("Failed to save totals", zap.String("shop", shopName), zap.Error(err))
+		return err
 	}
+
+	s.logger.Debug("totals saved", zap.String("service", "metrics"), zap.String("shop", shopName))
+	return nil
 }
 
-func (s *ServiceMetrics) UpdateSheet(ctx context.Context, shopName string, metrics avito.AvitoMetricsData) error {
-	s.logger.Debug("updating google sheet", zap.String("service", "metrics"))
+func (s *ServiceMetrics) SaveItems(ctx context.Context, shop config.Shop, items []avito.ItemMetrics) error {
+	s.logger.Debug("saving items", zap.String("service", "metrics"), zap.String("shop", shop.Name))
 
-	if err := s.repository.UpdateGoogleSheet(ctx, shopName, metrics); err != nil {
-		s.logger.Error("Failed to update sheet", zap.Error(err))
+	now := s.clock.Now()
+	loc := s.zones.Shop(shop.Name)
+	day := clock.Day(now, loc)
+	midnight, _ := clock.At(now, loc, "00:00")
+	base := s.itemState.baseline(shop.Name, day, midnight, now)
+	s.logger.Debug("computing item diffs", zap.String("shop", shop.Name), zap.Duration("window", now.Sub(base.Taken)))
+
+	rows := hourlyRows(items, base)
+	if err := s.sink.SaveItems(ctx, shop, rows); err != nil {
+		s.logger.Error("Failed to save items", zap.String("shop", shop.Name), zap.Error(err))
 		return err
 	}
 
-	s.logger.Debug("google sheet updated", zap.String("service", "metrics"))
+	// выгрузка становится базой только после успешной записи
+	if err := s.itemState.commit(shop.Name, day, now, items); err != nil {
+		s.logger.Warn("Failed to persist item state", zap.String("shop", shop.Name), zap.Error(err))
+	}
+	return nil
+}
+
+// SaveSnapshotsIfDue снимает снапшоты всех наступивших и ещё не снятых слотов текущего дня в поясе магазина.
+// Слот, пропущенный из-за рестарта, задержки тика или ошибки, догоняется на следующих тиках,
+// пока не выйдет окно SnapshotCatchUp.Grace; после этого он помечается пропущенным.
+// Если упала запись только в часть sinks, повтор пишет только в них
+func (s *ServiceMetrics) SaveSnapshotsIfDue(ctx context.Context) error {
+	now := s.clock.Now()
+
+	var errs []error
+	for _, shop := range s.cfg.Shops {
+		loc := s.zones.Shop(shop.Name)
+		day := clock.Day(now, loc)
+		for _, snap := range shop.Snapshots {
+			slotAt, err := clock.At(now, loc, snap.Time)
+			if err != nil {
+				s.logger.Error("Invalid snapshot time", zap.String("shop", shop.Name), zap.String("slot", snap.Time), zap.Error(err))
+				continue
+			}
+			if now.Before(slotAt) {
+				continue
+			}
+
+			st := s.snapState.get(day, shop.Name, snap.Time)
+			if st.Status != SlotPending {
+				continue
+			}
+
+			late := now.Sub(slotAt)
+			if late > s.snapshotGrace() {
+				st.Status = SlotMissed
+				s.setSlot(day, shop.Name, snap.Time, st)
+				s.logger.Warn("Snapshot slot missed, catch-up window expired",
+					zap.String("shop", shop.Name), zap.String("slot", snap.Time), zap.Duration("late", late),
+					zap.Int("attempts", st.Attempts), zap.String("lastError", st.LastError))
+				continue
+			}
+
+			saved, err := s.saveSnapshot(ctx, shop, snap, day, st.Sinks)
+			if errors.Is(err, errNoTotals) {
+				// итоги ещё не выгружены, например сразу после старта: ждём следующего тика
+				st.LastError = err.Error()
+				s.setSlot(day, shop.Name, snap.Time, st)
+				s.logger.Debug("Snapshot is waiting for totals", zap.String("shop", shop.Name), zap.String("slot", snap.Time))
+				continue
+			}
+			if err != nil {
+				st.Attempts++
+				st.LastError = err.Error()
+				st.Sinks = saved
+				s.setSlot(day, shop.Name, snap.Time, st)
+				s.logger.Error("Failed to save snapshot, will retry on next tick",
+					zap.String("shop", shop.Name), zap.String("slot", snap.Time), zap.Int("attempt", st.Attempts), zap.Error(err))
+				errs = append(errs, fmt.Errorf("shop %s slot %s: %w", shop.Name, snap.Time, err))
+				continue
+			}
+
+			s.setSlot(day, shop.Name, snap.Time, SlotState{Status: SlotTaken, Taken: now, Late: late, Attempts: st.Attempts + 1, Sinks: saved})
+			if late >= time.Minute {
+				s.logger.Warn("Snapshot captured late", zap.String("shop", shop.Name), zap.String("slot", snap.Time),
+					zap.Duration("late", late), zap.Int("attempts", st.Attempts+1))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SaveSnapshotsNow сохраняет снапшоты без проверки времени слота. Снапшот пишется за сегодняшний день
+// в поясе магазина; снятыми отмечаются только наступившие слоты, чтобы снапшот ещё не наступившего слота
+// всё равно снялся по расписанию. Пустые shopName и slot — все магазины и все слоты.
+// Возвращает число сохранённых снапшотов
+func (s *ServiceMetrics) SaveSnapshotsNow(ctx context.Context, shopName, slot string) (int, error) {
+	now := s.clock.Now()
+
+	saved := 0
+	var errs []error
+	for _, shop := range s.cfg.Shops {
+		if shopName != "" && shop.Name != shopName {
+			continue
+		}
+		for _, snap := range shop.Snapshots {
+			if slot != "" && snap.Time != slot {
+				continue
+			}
+			loc := s.zones.Shop(shop.Name)
+			day := clock.Day(now, loc)
+			sinks, err := s.saveSnapshot(ctx, shop, snap, day, nil)
+			if err != nil {
+				s.logger.Error("Failed to save snapshot", zap.String("shop", shop.Name), zap.String("slot", snap.Time), zap.Error(err))
+				errs = append(errs, fmt.Errorf("shop %s slot %s: %w", shop.Name, snap.Time, err))
+				continue
+			}
+			saved++
+			if slotAt, err := clock.At(now, loc, snap.Time); err != nil || now.Before(slotAt) {
+				continue
+			}
+			s.setSlot(day, shop.Name, snap.Time, SlotState{Status: SlotTaken, Taken: now, Sinks: sinks})
+		}
+	}
+	return saved, errors.Join(errs...)
+}
+
+// SnapshotSlots — состояние слотов снапшотов магазинов за текущий день в поясе каждого магазина
+func (s *ServiceMetrics) SnapshotSlots() map[string]map[string]SlotState {
+	now := s.clock.Now()
+	res := make(map[string]map[string]SlotState, len(s.cfg.Shops))
+	for _, shop := range s.cfg.Shops {
+		if slots := s.snapState.Slots(clock.Day(now, s.zones.Shop(shop.Name)), shop.Name); len(slots) > 0 {
+			res[shop.Name] = slots
+		}
+	}
+	return res
+}
+
+// saveSnapshot пишет снапшот слота дня day из последних итоговых метрик магазина в sinks, кроме done,
+// и возвращает sinks, в которые снапшот записан
+func (s *ServiceMetrics) saveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, done []string) ([]string, error) {
+	s.mu.Lock()
+	data, ok := s.latest[shop.Name]
+	s.mu.Unlock()
+	if !ok {
+		return done, errNoTotals
+	}
+
+	if f, ok := s.sink.(*FanOut); ok {
+		return f.SaveSnapshotExcept(ctx, shop, snap, day, data, done)
+	}
+	if slices.Contains(done, s.sink.Name()) {
+		return done, nil
+	}
+	if err := s.sink.SaveSnapshot(ctx, shop, snap, day, data); err != nil {
+		return done, err
+	}
+	return append(done, s.sink.Name()), nil
+}
+
+func (s *ServiceMetrics) setSlot(day, shopName, slot string, st SlotState) {
+	if err := s.snapState.set(day, shopName, slot, st); err != nil {
+		// слот уже обработан, после рестарта он может быть снят ещё раз
+		s.logger.Warn("Failed to persist snapshot state", zap.String("shop", shopName), zap.Error(err))
+	}
+}
+
+func (s *ServiceMetrics) snapshotGrace() time.Duration {
+	if s.cfg.SnapshotCatchUp.Grace > 0 {
+		return s.cfg.SnapshotCatchUp.Grace
+	}
+	return defaultSnapshotGrace
+}
+
+func (s *ServiceMetrics) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	if err := s.sink.AppendHistory(ctx, shopName, grouping, periods); err != nil {
+		s.logger.Error("Failed to append history", zap.String("shop", shopName), zap.Error(err))
+		return err
+	}
 	return nil
 }
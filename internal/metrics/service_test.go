@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestItemDiffsAgainstHourOldBaseline(t *testing.T) {
+	shop := config.Shop{Name: "main", Timezone: "UTC", ItemsSheetRange: "Items!A2:O"}
+	cfg := config.Config{Shops: []config.Shop{shop}}
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	repo, sheets := newTestRepo(t, cfg, clk)
+	zones, _ := cfg.Zones()
+	itemState, _ := NewItemStateStore("")
+	service := NewServiceMetrics(zap.NewNop(), cfg, zones, clk, repo, itemState, nil)
+	ctx := context.Background()
+
+	steps := []struct {
+		at          string // время запуска, 2026-10-17 если без даты
+		impressions int
+		fail        bool
+		want        int // прирост показов, колонка K
+	}{
+		{at: "09:00", impressions: 50, want: 50}, // базы нет — от полуночи
+		{at: "10:00", impressions: 100, want: 50},
+		{at: "10:30", impressions: 130, want: 80}, // ручной запуск: 10:00 моложе часа, база 09:00
+		{at: "11:00", impressions: 160, fail: true},
+		{at: "12:00", impressions: 200, want: 70}, // неудачная запись в 11:00 базой не стала
+		{at: "2026-10-18 00:00", impressions: 20, want: 20},
+	}
+	for _, step := range steps {
+		at := step.at
+		if len(at) == len("15:04") {
+			at = "2026-10-17 " + at
+		}
+		now, err := time.Parse("2006-01-02 15:04", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clk.Set(now)
+		if step.fail {
+			sheets.FailNext(errors.New("sheets unavailable"))
+		}
+
+		err = service.SaveItems(ctx, shop, []avito.ItemMetrics{{ID: 1, Title: "Sofa", Impressions: step.impressions}})
+		if step.fail {
+			if err == nil {
+				t.Fatalf("%s: SaveItems succeeded, want the sheets error", step.at)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: SaveItems: %v", step.at, err)
+		}
+		got, _ := sheets.ReadRange(ctx, "Items!K2")
+		if len(got) != 1 || got[0][0] != strconv.Itoa(step.want) {
+			t.Errorf("%s: impressions diff = %v, want %d", step.at, got, step.want)
+		}
+	}
+}
+
+// countingSink считает записи снапшотов; первые fail записей падают
+type countingSink struct {
+	name      string
+	fail      int
+	snapshots int
+}
+
+func (c *countingSink) Name() string { return c.name }
+
+func (c *countingSink) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	return nil
+}
+
+func (c *countingSink) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	return nil
+}
+
+func (c *countingSink) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	if c.fail > 0 {
+		c.fail--
+		return errors.New("sink unavailable")
+	}
+	c.snapshots++
+	return nil
+}
+
+func (c *countingSink) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	return nil
+}
+
+func TestSnapshotRetryWritesOnlyFailedSinks(t *testing.T) {
+	shop := config.Shop{Name: "main", Timezone: "UTC", Sinks: []string{"sheets", "history"},
+		Snapshots: []config.SnapshotTime{{Time: "10:00", Range: "Snapshots!B2:E2"}}}
+	cfg := config.Config{Shops: []config.Shop{shop}}
+	zones, _ := cfg.Zones()
+	sheets, history := &countingSink{name: "sheets"}, &countingSink{name: "history", fail: 2}
+	fanOut, err := NewFanOut(zap.NewNop(), cfg, sheets, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := clock.NewFake(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	snapState, _ := NewSnapshotStateStore("")
+	service := NewServiceMetrics(zap.NewNop(), cfg, zones, clk, fanOut, nil, snapState)
+	ctx := context.Background()
+	if err := service.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// два тика history падает, третий записывает; sheets записан один раз
+	for tick := 0; tick < 3; tick++ {
+		err := service.SaveSnapshotsIfDue(ctx)
+		if (tick < 2) != (err != nil) {
+			t.Fatalf("tick %d: err = %v", tick, err)
+		}
+		clk.Advance(time.Minute)
+	}
+	if sheets.snapshots != 1 || history.snapshots != 1 {
+		t.Errorf("snapshots written: sheets %d, history %d; want 1 and 1", sheets.snapshots, history.snapshots)
+	}
+	st := snapState.get("2026-10-17", shop.Name, "10:00")
+	if st.Status != SlotTaken || st.Attempts != 3 || len(st.Sinks) != 2 {
+		t.Errorf("slot = %+v, want taken on attempt 3 with both sinks", st)
+	}
+}
+
+func TestSnapshotSlotsOnFakeClock(t *testing.T) {
+	shop := config.Shop{Name: "main", Timezone: "UTC", SheetRange: "Totals!B2:B5", Snapshots: []config.SnapshotTime{
+		{Time: "10:00", Range: "Snapshots!B2:E2"},
+		{Time: "11:00", Range: "Snapshots!B3:E3"},
+	}}
+	cfg := config.Config{Shops: []config.Shop{shop}, SnapshotCatchUp: config.SnapshotCatchUp{Grace: 20 * time.Minute}}
+	clk := clock.NewFake(time.Date(2026, 10, 17, 9, 59, 0, 0, time.UTC))
+	repo, sheets := newTestRepo(t, cfg, clk)
+	zones, _ := cfg.Zones()
+	snapState, _ := NewSnapshotStateStore("")
+	service := NewServiceMetrics(zap.NewNop(), cfg, zones, clk, repo, nil, snapState)
+	ctx := context.Background()
+
+	steps := []struct {
+		at    string // время тика
+		slots map[string]string
+		row2  string // расход в Snapshots!B2 после тика
+	}{
+		{at: "2026-10-17 09:59", slots: map[string]string{}},
+		{at: "2026-10-17 10:05", slots: map[string]string{"10:00": SlotTaken}, row2: "100"},
+		// процесс стоял с 10:05 до 11:30: окно догоняющего снятия 11:00 истекло
+		{at: "2026-10-17 11:30", slots: map[string]string{"10:00": SlotTaken, "11:00": SlotMissed}, row2: "100"},
+		// новый день: слоты снова ждут
+		{at: "2026-10-18 00:01", slots: map[string]string{}, row2: "100"},
+		{at: "2026-10-18 10:00", slots: map[string]string{"10:00": SlotTaken}, row2: "200"},
+	}
+	for _, step := range steps {
+		now, _ := time.Parse("2006-01-02 15:04", step.at)
+		clk.Set(now)
+		spending := 100
+		if now.Day() == 18 {
+			spending = 200
+		}
+		if err := service.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: spending * 100}); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.SaveSnapshotsIfDue(ctx); err != nil {
+			t.Fatalf("%s: SaveSnapshotsIfDue: %v", step.at, err)
+		}
+
+		got := snapState.Slots(clock.Day(now, time.UTC), shop.Name)
+		if len(got) != len(step.slots) {
+			t.Fatalf("%s: slots = %+v, want %v", step.at, got, step.slots)
+		}
+		for slot, want := range step.slots {
+			if got[slot].Status != want {
+				t.Errorf("%s: slot %s = %s, want %s", step.at, slot, got[slot].Status, want)
+			}
+		}
+		row, _ := sheets.ReadRange(ctx, "Snapshots!B2")
+		if (step.row2 == "") != (len(row) == 0) || (len(row) > 0 && row[0][0] != step.row2) {
+			t.Errorf("%s: Snapshots!B2 = %v, want %q", step.at, row, step.row2)
+		}
+	}
+}
+
+// daySink запоминает расход последнего снапшота по дню и слоту, как строки slot_snapshots
+type daySink struct {
+	countingSink
+	rows map[string]int // "день слот" -> расход
+}
+
+func (d *daySink) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	d.rows[day+" "+snap.Time] = data.Spending
+	return nil
+}
+
+func TestForcedSnapshotOfFutureSlot(t *testing.T) {
+	shop := config.Shop{Name: "main", Timezone: "UTC", Snapshots: []config.SnapshotTime{{Time: "10:00", Range: "Snapshots!B2:E2"}}}
+	cfg := config.Config{Shops: []config.Shop{shop}}
+	zones, _ := cfg.Zones()
+	sink := &daySink{countingSink: countingSink{name: "postgres"}, rows: map[string]int{}}
+	clk := clock.NewFake(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	snapState, _ := NewSnapshotStateStore("")
+	service := NewServiceMetrics(zap.NewNop(), cfg, zones, clk, sink, nil, snapState)
+	ctx := context.Background()
+
+	tick := func(spending int) {
+		t.Helper()
+		if err := service.SaveTotals(ctx, shop.Name, avito.AvitoMetricsData{Spending: spending}); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.SaveSnapshotsIfDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tick(100)
+
+	// 08:00 следующего дня снапшот слота 10:00 снимают вручную
+	clk.Set(time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC))
+	tick(150)
+	if saved, err := service.SaveSnapshotsNow(ctx, shop.Name, "10:00"); err != nil || saved != 1 {
+		t.Fatalf("SaveSnapshotsNow = %d, %v; want 1 snapshot", saved, err)
+	}
+	if st := service.SnapshotSlots()[shop.Name]["10:00"]; st.Status == SlotTaken {
+		t.Errorf("slot after the forced snapshot = %+v, want it still pending", st)
+	}
+
+	// в 10:00 слот снимается по расписанию
+	clk.Set(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	tick(200)
+	if st := service.SnapshotSlots()[shop.Name]["10:00"]; st.Status != SlotTaken {
+		t.Errorf("slot at 10:00 = %+v, want taken", st)
+	}
+
+	want := map[string]int{"2026-10-16 10:00": 100, "2026-10-17 10:00": 200}
+	if len(sink.rows) != len(want) || sink.rows["2026-10-16 10:00"] != 100 || sink.rows["2026-10-17 10:00"] != 200 {
+		t.Errorf("snapshot rows = %v, want %v", sink.rows, want)
+	}
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// DefaultSinks — sinks магазина, если ни Sinks, ни Shop.Sinks не заданы
+var DefaultSinks = []string{"sheets"}
+
+// FanOut раздаёт одну выгрузку всем sinks, включённым для магазина.
+// Ошибка одного sink не мешает записи в остальные: все ошибки возвращаются вместе
+type FanOut struct {
+	logger *zap.Logger
+	sinks  map[string]Sink     // ключ = Sink.Name()
+	shops  map[string][]string // магазин -> включённые sinks
+}
+
+func NewFanOut(logger *zap.Logger, cfg config.Config, sinks ...Sink) (*FanOut, error) {
+	f := &FanOut{
+		logger: logger,
+		sinks:  make(map[string]Sink, len(sinks)),
+		shops:  make(map[string][]string, len(cfg.Shops)),
+	}
+	for _, s := range sinks {
+		f.sinks[s.Name()] = s
+	}
+
+	defaults := cfg.Sinks
+	if len(defaults) == 0 {
+		defaults = DefaultSinks
+	}
+
+	for _, shop := range cfg.Shops {
+		enabled := shop.Sinks
+		if len(enabled) == 0 {
+			enabled = defaults
+		}
+		for _, name := range enabled {
+			if _, ok := f.sinks[name]; !ok {
+				return nil, fmt.Errorf("shop %s: sink %q is not configured", shop.Name, name)
+			}
+		}
+		f.shops[shop.Name] = enabled
+	}
+
+	return f, nil
+}
+
+func (f *FanOut) Name() string {
+	return "fanout"
+}
+
+func (f *FanOut) SaveTotals(ctx context.Context, shopName string, data avito.AvitoMetricsData) error {
+	return f.each(shopName, "totals", func(s Sink) error { return s.SaveTotals(ctx, shopName, data) })
+}
+
+func (f *FanOut) SaveItems(ctx context.Context, shop config.Shop, items []ItemHourly) error {
+	return f.each(shop.Name, "items", func(s Sink) error { return s.SaveItems(ctx, shop, items) })
+}
+
+func (f *FanOut) SaveSnapshot(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData) error {
+	return f.each(shop.Name, "snapshot", func(s Sink) error { return s.SaveSnapshot(ctx, shop, snap, day, data) })
+}
+
+func (f *FanOut) AppendHistory(ctx context.Context, shopName, grouping string, periods []avito.PeriodMetrics) error {
+	return f.each(shopName, "history", func(s Sink) error { return s.AppendHistory(ctx, shopName, grouping, periods) })
+}
+
+// SaveSnapshotExcept пишет снапшот в sinks магазина, кроме done, и возвращает done вместе с sinks,
+// запись в которые удалась. Повтор слота после ошибки одного sink не дублирует снапшот в остальных
+func (f *FanOut) SaveSnapshotExcept(ctx context.Context, shop config.Shop, snap config.SnapshotTime, day string, data avito.AvitoMetricsData, done []string) ([]string, error) {
+	return f.eachExcept(shop.Name, "snapshot", done, func(s Sink) error { return s.SaveSnapshot(ctx, shop, snap, day, data) })
+}
+
+func (f *FanOut) each(shopName, op string, fn func(s Sink) error) error {
+	_, err := f.eachExcept(shopName, op, nil, fn)
+	return err
+}
+
+// eachExcept вызывает fn для sinks магазина, кроме done, и возвращает done вместе с успешными
+func (f *FanOut) eachExcept(shopName, op string, done []string, fn func(s Sink) error) ([]string, error) {
+	names, ok := f.shops[shopName]
+	if !ok {
+		return done, fmt.Errorf("shop %s not found in config", shopName)
+	}
+
+	saved := slices.Clone(done)
+	var errs []error
+	for _, name := range names {
+		if slices.Contains(done, name) {
+			continue
+		}
+		if err := fn(f.sinks[name]); err != nil {
+			f.logger.Error("Sink failed", zap.String("sink", name), zap.String("op", op), zap.String("shop", shopName), zap.Error(err))
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+			continue
+		}
+		saved = append(saved, name)
+	}
+	return saved, errors.Join(errs...)
+}
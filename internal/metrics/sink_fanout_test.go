@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Упавший sink не мешает записи в остальные: webhook стоит первым, csv всё равно получает выгрузку
+func TestFanOutFailingSinkDoesNotBlockOthers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{name: "bad status", handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}, wantErr: "sink webhook: webhook bad status: 500 Internal Server Error"},
+		{name: "hangs", handler: func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}, wantErr: "sink webhook: webhook request failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			cfg := config.Config{Shops: []config.Shop{
+				{Name: "main", Sinks: []string{"webhook", "csv"}},
+				{Name: "second", Sinks: []string{"csv"}},
+			}}
+			clk := clock.NewFake(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+			dir := t.TempDir()
+			csvRepo, err := NewRepositoryCSV(zap.NewNop(), dir, clk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			webhook := NewRepositoryWebhook(zap.NewNop(), srv.URL, 50*time.Millisecond, clk)
+			fanOut, err := NewFanOut(zap.NewNop(), cfg, webhook, csvRepo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			err = fanOut.SaveTotals(ctx, "main", avito.AvitoMetricsData{Spending: 100})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("SaveTotals err = %v, want %q", err, tt.wantErr)
+			}
+			items := []ItemHourly{{ItemMetrics: avito.ItemMetrics{ID: 42, Title: "Sofa"}}}
+			err = fanOut.SaveItems(ctx, cfg.Shops[0], items)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("SaveItems err = %v, want %q", err, tt.wantErr)
+			}
+			// магазин без webhook ошибку не видит
+			if err := fanOut.SaveTotals(ctx, "second", avito.AvitoMetricsData{Spending: 200}); err != nil {
+				t.Errorf("SaveTotals for a shop without webhook: %v", err)
+			}
+
+			totals := readCSV(t, filepath.Join(dir, "totals.csv"))
+			if len(totals) != 3 || totals[1][1] != "main" || totals[1][2] != "100" || totals[2][1] != "second" {
+				t.Errorf("totals.csv = %q, want rows of main and second", totals)
+			}
+			if got := readCSV(t, filepath.Join(dir, "items.csv")); len(got) != 2 || got[1][2] != "42" {
+				t.Errorf("items.csv = %q, want the item of main", got)
+			}
+		})
+	}
+}
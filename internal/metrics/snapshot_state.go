@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	SlotPending = "pending" // слот ещё не снят: не наступил, ждёт данных или повтора после ошибки
+	SlotTaken   = "taken"
+	SlotMissed  = "missed" // окно догоняющего снятия истекло
+)
+
+// SlotState — состояние слота снапшота магазина за день
+type SlotState struct {
+	Status    string
+	Taken     time.Time
+	Late      time.Duration `json:",omitempty"` // насколько позже слота снят снапшот
+	Attempts  int           `json:",omitempty"`
+	LastError string        `json:",omitempty"`
+	Sinks     []string      `json:",omitempty"` // куда снапшот уже записан: повтор после ошибки пишет только в остальные
+}
+
+// SnapshotStateStore хранит, какие слоты снапшотов уже сняты за день в поясе магазина,
+// чтобы после рестарта или сбоя догонять пропущенные. С непустым path состояние переживает рестарт
+type SnapshotStateStore struct {
+	mu   sync.Mutex
+	path string
+	days map[string]map[string]map[string]SlotState // день -> магазин -> слот
+}
+
+// path == "" — состояние только в памяти
+func NewSnapshotStateStore(path string) (*SnapshotStateStore, error) {
+	s := &SnapshotStateStore{path: path, days: make(map[string]map[string]map[string]SlotState)}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot state: %w", err)
+	}
+	if err := json.Unmarshal(b, &s.days); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot state: %w", err)
+	}
+	return s, nil
+}
+
+func (s *SnapshotStateStore) get(day, shopName, slot string) SlotState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.days[day][shopName][slot]; ok {
+		return st
+	}
+	return SlotState{Status: SlotPending}
+}
+
+// set сохраняет состояние слота и забывает дни старше day больше чем на сутки: за них снимать уже нечего.
+// Вчерашний день остаётся — у магазинов в других поясах он может ещё идти
+func (s *SnapshotStateStore) set(day, shopName, slot string, st SlotState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, err := time.Parse("2006-01-02", day); err == nil {
+		keep := t.AddDate(0, 0, -1).Format("2006-01-02")
+		for d := range s.days {
+			if d < keep {
+				delete(s.days, d)
+			}
+		}
+	}
+	if s.days[day] == nil {
+		s.days[day] = make(map[string]map[string]SlotState)
+	}
+	if s.days[day][shopName] == nil {
+		s.days[day][shopName] = make(map[string]SlotState)
+	}
+	s.days[day][shopName][slot] = st
+	return s.save()
+}
+
+// Slots возвращает состояние слотов магазина за день, для диагностики
+func (s *SnapshotStateStore) Slots(day, shopName string) map[string]SlotState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]SlotState, len(s.days[day][shopName]))
+	for slot, st := range s.days[day][shopName] {
+		res[slot] = st
+	}
+	return res
+}
+
+// вызывается под s.mu
+func (s *SnapshotStateStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(s.days)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("unable to write snapshot state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to write snapshot state: %w", err)
+	}
+	return nil
+}
+
+// snapshotDay — день в поясе loc, к которому относится снапшот слота slot ("15:04") на момент now:
+// слот, время которого сегодня ещё не наступило, снят вчера
+func snapshotDay(now time.Time, loc *time.Location, slot string) string {
+	now = now.In(loc)
+	if slot > now.Format("15:04") {
+		now = now.AddDate(0, 0, -1)
+	}
+	return now.Format("2006-01-02")
+}
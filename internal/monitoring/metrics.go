@@ -0,0 +1,181 @@
+package monitoring
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "avitotool"
+
+var (
+	shopSpending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shop_spending_rubles",
+		Help:      "Spending of the shop for the current day, rubles.",
+	}, []string{"shop"})
+	shopImpressions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shop_impressions",
+		Help:      "Impressions of the shop for the current day.",
+	}, []string{"shop"})
+	shopViews = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shop_views",
+		Help:      "Views of the shop for the current day.",
+	}, []string{"shop"})
+	shopContacts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shop_contacts",
+		Help:      "Contacts of the shop for the current day.",
+	}, []string{"shop"})
+
+	itemSpending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "item_spending_rubles",
+		Help:      "Spending of the item for the current day, rubles. Exported only with Monitoring.PerItem.",
+	}, []string{"shop", "item_id"})
+	itemImpressions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "item_impressions",
+		Help:      "Impressions of the item for the current day. Exported only with Monitoring.PerItem.",
+	}, []string{"shop", "item_id"})
+	itemViews = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "item_views",
+		Help:      "Views of the item for the current day. Exported only with Monitoring.PerItem.",
+	}, []string{"shop", "item_id"})
+	itemContacts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "item_contacts",
+		Help:      "Contacts of the item for the current day. Exported only with Monitoring.PerItem.",
+	}, []string{"shop", "item_id"})
+
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shop_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful run for the shop.",
+	}, []string{"shop", "job"})
+	shopFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shop_failures_total",
+		Help:      "Failed shop runs by error kind.",
+	}, []string{"shop", "job", "kind"})
+
+	avitoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "avito_request_duration_seconds",
+		Help:      "Duration of a single Avito API attempt.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+	avitoRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "avito_requests_total",
+		Help:      "Avito API attempts by endpoint and HTTP status, status=error for transport errors.",
+	}, []string{"endpoint", "status"})
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "avito_token_refreshes_total",
+		Help:      "Avito token refreshes by result.",
+	}, []string{"result"})
+
+	sheetsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sheets_request_duration_seconds",
+		Help:      "Duration of a Google Sheets API call.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+	sheetsRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sheets_requests_total",
+		Help:      "Google Sheets API calls by operation and HTTP status, status=error when unknown.",
+	}, []string{"op", "status"})
+
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Scheduled job runs by outcome: ok, failed, panic or skipped.",
+	}, []string{"job", "outcome"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of scheduled jobs.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"job"})
+)
+
+// Суммы в метриках Avito в копейках, в Prometheus отдаём рубли
+func rubles(penny int) float64 {
+	return float64(penny) / 100
+}
+
+// ShopTotals — последние итоговые метрики магазина
+func ShopTotals(shop string, spending, impressions, views, contacts int) {
+	shopSpending.WithLabelValues(shop).Set(rubles(spending))
+	shopImpressions.WithLabelValues(shop).Set(float64(impressions))
+	shopViews.WithLabelValues(shop).Set(float64(views))
+	shopContacts.WithLabelValues(shop).Set(float64(contacts))
+}
+
+// ItemTotals — последние метрики объявления
+func ItemTotals(shop string, itemID int64, spending, impressions, views, contacts int) {
+	id := strconv.FormatInt(itemID, 10)
+	itemSpending.WithLabelValues(shop, id).Set(rubles(spending))
+	itemImpressions.WithLabelValues(shop, id).Set(float64(impressions))
+	itemViews.WithLabelValues(shop, id).Set(float64(views))
+	itemContacts.WithLabelValues(shop, id).Set(float64(contacts))
+}
+
+// ResetItems удаляет метрики объявлений магазина, чтобы снятые с публикации не висели в экспорте
+func ResetItems(shop string) {
+	labels := prometheus.Labels{"shop": shop}
+	itemSpending.DeletePartialMatch(labels)
+	itemImpressions.DeletePartialMatch(labels)
+	itemViews.DeletePartialMatch(labels)
+	itemContacts.DeletePartialMatch(labels)
+}
+
+func ShopSucceeded(shop, job string, at time.Time) {
+	lastSuccess.WithLabelValues(shop, job).Set(float64(at.Unix()))
+}
+
+func ShopFailed(shop, job, kind string) {
+	shopFailures.WithLabelValues(shop, job, kind).Inc()
+}
+
+// AvitoRequest — одна попытка запроса к Avito. status == 0 — ошибка транспорта
+func AvitoRequest(endpoint string, status int, d time.Duration) {
+	avitoDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+	avitoRequests.WithLabelValues(endpoint, statusLabel(status)).Inc()
+}
+
+func TokenRefresh(err error) {
+	if err != nil {
+		tokenRefreshes.WithLabelValues("error").Inc()
+		return
+	}
+	tokenRefreshes.WithLabelValues("ok").Inc()
+}
+
+// SheetsRequest — один вызов Sheets API. status == 0 — код ответа неизвестен
+func SheetsRequest(op string, status int, d time.Duration) {
+	sheetsDuration.WithLabelValues(op).Observe(d.Seconds())
+	sheetsRequests.WithLabelValues(op, statusLabel(status)).Inc()
+}
+
+func JobDuration(job string, d time.Duration) {
+	jobDuration.WithLabelValues(job).Observe(d.Seconds())
+}
+
+func JobRun(job, outcome string) {
+	jobRuns.WithLabelValues(job, outcome).Inc()
+}
+
+func statusLabel(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
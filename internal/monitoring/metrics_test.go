@@ -0,0 +1,184 @@
+package monitoring_test
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/client/avito/avitofake"
+	"avitoproject/internal/client/google/sheetsfake"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/metrics"
+	"avitoproject/internal/monitoring"
+	"avitoproject/internal/worker"
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Реестр метрик общий для процесса: у каждого теста свои имена магазинов, чтобы серии не пересекались
+type testEnv struct {
+	worker *worker.Worker
+	avito  *avitofake.Server
+	shops  []config.Shop
+}
+
+// newTestEnv — worker с Monitoring.PerItem поверх фейков Avito и Sheets, по аккаунту на магазин
+func newTestEnv(t *testing.T, names ...string) *testEnv {
+	t.Helper()
+	cfg := config.Config{Monitoring: config.Monitoring{PerItem: true}}
+	env := &testEnv{avito: avitofake.NewServer()}
+	for i, name := range names {
+		shop := config.Shop{
+			Name: name, ClientId: name, ClientSecret: "secret", UserId: i + 1,
+			SheetRange:      fmt.Sprintf("Totals%d!B2:B5", i),
+			ItemsSheetRange: fmt.Sprintf("Items%d!A2:O", i),
+		}
+		cfg.Shops = append(cfg.Shops, shop)
+		env.avito.AddAccount(avitofake.Account{UserId: shop.UserId, ClientId: shop.ClientId, ClientSecret: shop.ClientSecret})
+	}
+	env.shops = cfg.Shops
+	zones, err := cfg.Zones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := clock.NewFake(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	env.avito.SetClock(clk)
+	t.Cleanup(env.avito.Close)
+
+	logger := zap.NewNop()
+	repo := metrics.NewRepositoryMetrics(logger, cfg, zones, clk, sheetsfake.New())
+	sink, err := metrics.NewFanOut(logger, cfg, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemState, _ := metrics.NewItemStateStore("")
+	snapState, _ := metrics.NewSnapshotStateStore("")
+	service := metrics.NewServiceMetrics(logger, cfg, zones, clk, sink, itemState, snapState)
+
+	client := avito.NewAvitoClient(logger, avito.Options{BaseUrl: env.avito.Start(), Retry: avito.RetryPolicy{MaxAttempts: 1}, Clock: clk})
+	env.worker = worker.NewWorker(logger, client, service, cfg, zones, clk)
+	return env
+}
+
+// scrape забирает /metrics через HTTP и возвращает серии без комментариев: строка серии -> значение
+func scrape(t *testing.T) map[string]string {
+	t.Helper()
+	srv := httptest.NewServer(monitoring.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: status %d", resp.StatusCode)
+	}
+
+	series := make(map[string]string)
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		series[line[:i]] = line[i+1:]
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return series
+}
+
+func expectSeries(t *testing.T, series map[string]string, want map[string]string) {
+	t.Helper()
+	for name, value := range want {
+		got, ok := series[name]
+		switch {
+		case !ok:
+			t.Errorf("%s is not exported", name)
+		case got != value:
+			t.Errorf("%s = %s, want %s", name, got, value)
+		}
+	}
+}
+
+func TestMetricsAfterRun(t *testing.T) {
+	env := newTestEnv(t, "mon-run")
+	env.avito.SetItems("mon-run", []avitofake.Item{
+		{ID: 1, Title: "Sofa", Impressions: 100, Views: 10, Contacts: 1, Spending: 5000},
+		{ID: 2, Title: "Chair", Impressions: 50, Views: 5, Spending: 2550},
+	})
+	ctx := context.Background()
+	for _, run := range append(env.worker.ProcessAllShops(ctx), env.worker.ProcessAllShopsItems(ctx)...) {
+		if run.Error != "" {
+			t.Fatalf("%s run failed: %s", run.Job, run.Error)
+		}
+	}
+
+	// суммы в копейках отдаются в рублях, время успеха — в секундах Unix
+	expectSeries(t, scrape(t), map[string]string{
+		`avitotool_shop_spending_rubles{shop="mon-run"}`:                             "75.5",
+		`avitotool_shop_impressions{shop="mon-run"}`:                                 "150",
+		`avitotool_shop_views{shop="mon-run"}`:                                       "15",
+		`avitotool_shop_contacts{shop="mon-run"}`:                                    "1",
+		`avitotool_item_spending_rubles{item_id="1",shop="mon-run"}`:                 "50",
+		`avitotool_item_spending_rubles{item_id="2",shop="mon-run"}`:                 "25.5",
+		`avitotool_item_impressions{item_id="2",shop="mon-run"}`:                     "50",
+		`avitotool_item_views{item_id="1",shop="mon-run"}`:                           "10",
+		`avitotool_item_contacts{item_id="1",shop="mon-run"}`:                        "1",
+		`avitotool_shop_last_success_timestamp_seconds{job="totals",shop="mon-run"}`: "1.7922384e+09",
+		`avitotool_shop_last_success_timestamp_seconds{job="items",shop="mon-run"}`:  "1.7922384e+09",
+	})
+}
+
+func TestMetricsAfterFailedRun(t *testing.T) {
+	env := newTestEnv(t, "mon-fail")
+	env.avito.FailNext("/stats/v2/accounts/1/items", avitofake.Failure{Status: http.StatusForbidden, Body: "no scope"})
+
+	if run := env.worker.ProcessAllShops(context.Background())[0]; run.Error == "" {
+		t.Fatal("totals run succeeded, want a 403")
+	}
+
+	series := scrape(t)
+	expectSeries(t, series, map[string]string{
+		`avitotool_shop_failures_total{job="totals",kind="forbidden",shop="mon-fail"}`: "1",
+	})
+	if _, ok := series[`avitotool_shop_last_success_timestamp_seconds{job="totals",shop="mon-fail"}`]; ok {
+		t.Error("last success exported for a failed run")
+	}
+}
+
+func TestResetItemsRemovesStaleSeries(t *testing.T) {
+	env := newTestEnv(t, "mon-reset", "mon-keep")
+	env.avito.SetItems("mon-reset", []avitofake.Item{{ID: 1, Spending: 100}, {ID: 2, Spending: 200}})
+	env.avito.SetItems("mon-keep", []avitofake.Item{{ID: 1, Spending: 300}})
+	ctx := context.Background()
+	env.worker.ProcessAllShopsItems(ctx)
+	expectSeries(t, scrape(t), map[string]string{`avitotool_item_spending_rubles{item_id="1",shop="mon-reset"}`: "1"})
+
+	// объявление 1 сняли с публикации: следующий запуск магазина его уже не видит
+	env.avito.SetItems("mon-reset", []avitofake.Item{{ID: 2, Spending: 400}})
+	env.worker.ProcessShopsItems(ctx, env.shops[:1])
+
+	series := scrape(t)
+	for _, name := range []string{"spending_rubles", "impressions", "views", "contacts"} {
+		stale := fmt.Sprintf(`avitotool_item_%s{item_id="1",shop="mon-reset"}`, name)
+		if _, ok := series[stale]; ok {
+			t.Errorf("stale series %s is still exported", stale)
+		}
+	}
+	expectSeries(t, series, map[string]string{
+		`avitotool_item_spending_rubles{item_id="2",shop="mon-reset"}`: "4",
+		// сброс касается только своего магазина
+		`avitotool_item_spending_rubles{item_id="1",shop="mon-keep"}`: "3",
+	})
+}
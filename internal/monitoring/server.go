@@ -0,0 +1,39 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Handler отдаёт все метрики процесса в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve поднимает /metrics на addr и останавливает сервер при отмене ctx
+func Serve(ctx context.Context, logger *zap.Logger, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Metrics server started", zap.String("addr", addr))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
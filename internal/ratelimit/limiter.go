@@ -0,0 +1,112 @@
+// Package ratelimit — token bucket для ограничения частоты запросов к внешним API.
+package ratelimit
+
+import (
+	"avitoproject/internal/clock"
+	"context"
+	"sync"
+	"time"
+)
+
+// Limit — частота в запросах в минуту и размер всплеска. PerMinute <= 0 — без ограничения
+type Limit struct {
+	PerMinute float64
+	Burst     int
+}
+
+type Limiter struct {
+	clock    clock.Clock
+	mu       sync.Mutex
+	interval time.Duration // время на пополнение одного токена
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter возвращает nil для неограниченного лимита; Wait на nil-лимитере не ждёт. clk == nil — clock.System
+func NewLimiter(limit Limit, clk clock.Clock) *Limiter {
+	if limit.PerMinute <= 0 {
+		return nil
+	}
+	burst := max(limit.Burst, 1)
+	clk = clock.Or(clk)
+	return &Limiter{
+		clock:    clk,
+		interval: time.Duration(float64(time.Minute) / limit.PerMinute),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     clk.Now(),
+	}
+}
+
+// Wait блокируется, пока не появится свободный токен, или до отмены ctx
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	l.last = now
+	// токен резервируется сразу, даже если его ещё нужно дождаться
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens * float64(l.interval))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	select {
+	case <-l.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		// возвращаем неиспользованный токен
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Group — лимитер на каждый ключ (например, client_id Avito) плюс общий лимитер на все ключи
+type Group struct {
+	clock  clock.Clock
+	mu     sync.Mutex
+	limit  Limit
+	keys   map[string]*Limiter
+	global *Limiter
+}
+
+// clk == nil — clock.System
+func NewGroup(perKey, global Limit, clk clock.Clock) *Group {
+	return &Group{
+		clock:  clk,
+		limit:  perKey,
+		keys:   make(map[string]*Limiter),
+		global: NewLimiter(global, clk),
+	}
+}
+
+func (g *Group) Wait(ctx context.Context, key string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	l, ok := g.keys[key]
+	if !ok {
+		l = NewLimiter(g.limit, g.clock)
+		g.keys[key] = l
+	}
+	g.mu.Unlock()
+
+	if err := l.Wait(ctx); err != nil {
+		return err
+	}
+	return g.global.Wait(ctx)
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"avitoproject/internal/clock"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterWaitsForRefillOnFakeClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	l := NewLimiter(Limit{PerMinute: 6, Burst: 2}, clk)
+	ctx := context.Background()
+
+	// всплеск проходит сразу
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// третий запрос ждёт пополнения токена: 10 секунд по часам лимитера
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); clk.Waiters() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("limiter did not wait")
+		}
+	}
+	clk.Advance(9 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("limiter released before the token was refilled")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// за минуту простоя бакет наполняется только до Burst
+	clk.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if clk.Waiters() != 0 {
+		t.Fatal("burst after idle minute had to wait")
+	}
+}
+
+func TestLimiterCancelReturnsToken(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	l := NewLimiter(Limit{PerMinute: 6, Burst: 1}, clk)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Fatal("Wait succeeded on a cancelled context")
+	}
+
+	// отменённое ожидание не заняло токен: следующий готов через те же 10 секунд
+	clk.Advance(10 * time.Second)
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("token of the cancelled wait was not returned")
+	}
+}
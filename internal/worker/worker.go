@@ -3,17 +3,47 @@ package worker
 import (
 	"avitoproject/config"
 	"avitoproject/internal/client/avito"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/jobs"
 	"avitoproject/internal/metrics"
+	"avitoproject/internal/monitoring"
 	"context"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
+// Имена задач в метриках мониторинга и в RunShop
+const (
+	JobTotals = "totals"
+	JobItems  = "items"
+)
+
 type Worker struct {
 	logger  *zap.Logger
 	avito   *avito.AvitoClient
 	service *metrics.ServiceMetrics
 	cfg     config.Config
+	zones   *clock.Zones
+	clock   clock.Clock
+	work    context.Context // отменяется, когда вышло время на остановку: обрывает начатые магазины
+
+	mu       sync.Mutex
+	disabled map[string]error                // магазин или магазин/задача с неисправимой ошибкой, до рестарта
+	runs     map[string]map[string]RunResult // магазин -> задача -> последний запуск
+}
+
+// RunResult — итог последнего запуска задачи по магазину
+type RunResult struct {
+	Shop     string
+	Job      string
+	Started  time.Time
+	Finished time.Time
+	Metrics  *avito.AvitoMetricsData `json:",omitempty"` // для totals
+	Items    int                     `json:",omitempty"` // для items
+	Error    string                  `json:",omitempty"`
 }
 
 func NewWorker(
@@ -21,33 +51,349 @@ func NewWorker(
 	avitoClient *avito.AvitoClient,
 	service *metrics.ServiceMetrics,
 	cfg config.Config,
+	zones *clock.Zones,
+	clk clock.Clock,
 ) *Worker {
 	return &Worker{
-		logger:  logger,
-		avito:   avitoClient,
-		service: service,
-		cfg:     cfg,
+		logger:   logger,
+		avito:    avitoClient,
+		service:  service,
+		cfg:      cfg,
+		zones:    zones,
+		clock:    clock.Or(clk),
+		work:     context.Background(),
+		disabled: make(map[string]error),
+		runs:     make(map[string]map[string]RunResult),
+	}
+}
+
+// SetWorkContext задаёт контекст, отмена которого обрывает уже начатую обработку магазинов.
+// Вызывается до запуска планировщиков
+func (w *Worker) SetWorkContext(ctx context.Context) {
+	w.work = ctx
+}
+
+// ProcessAllShops обновляет итоговые метрики всех магазинов
+func (w *Worker) ProcessAllShops(ctx context.Context) []RunResult {
+	return w.ProcessShops(ctx, w.cfg.Shops)
+}
+
+// ProcessShops обновляет итоговые метрики переданных магазинов и возвращает итог по каждому обработанному
+func (w *Worker) ProcessShops(ctx context.Context, shops []config.Shop) []RunResult {
+	return w.forEachShop(ctx, JobTotals, shops, w.processShop)
+}
+
+// ProcessAllShopsItems обновляет таблицы по объявлениям у магазинов с ItemsSheetRange
+func (w *Worker) ProcessAllShopsItems(ctx context.Context) []RunResult {
+	return w.ProcessShopsItems(ctx, w.cfg.Shops)
+}
+
+// ProcessShopsItems обновляет таблицы по объявлениям у переданных магазинов с ItemsSheetRange
+func (w *Worker) ProcessShopsItems(ctx context.Context, list []config.Shop) []RunResult {
+	var shops []config.Shop
+	for _, shop := range list {
+		if shop.ItemsSheetRange != "" {
+			shops = append(shops, shop)
+		}
+	}
+	return w.forEachShop(ctx, JobItems, shops, w.processShopItems)
+}
+
+// forEachShop обрабатывает магазины пулом из RateLimit.Concurrency горутин.
+// Частоту запросов к Avito ограничивает лимитер клиента, поэтому пауз между магазинами нет.
+// После отмены ctx новые магазины не берутся, а начатые доделываются, чтобы не обрывать запись
+// на середине, пока не отменён контекст SetWorkContext: его отменяет main по таймауту остановки.
+// Паника при обработке магазина не роняет процесс, а становится ошибкой этого магазина
+func (w *Worker) forEachShop(ctx context.Context, job string, list []config.Shop, fn func(ctx context.Context, shop config.Shop) RunResult) []RunResult {
+	shops := make(chan config.Shop)
+	var wg sync.WaitGroup
+	var resMu sync.Mutex
+	var results []RunResult
+
+	for i := 0; i < max(w.cfg.RateLimit.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shop := range shops {
+				shopCtx, cancel := w.shopContext(ctx)
+				run := w.safeRun(shopCtx, job, shop, fn)
+				cancel()
+				resMu.Lock()
+				results = append(results, run)
+				resMu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, shop := range list {
+		select {
+		case shops <- shop:
+		case <-ctx.Done():
+			w.logger.Warn("Run cancelled, remaining shops skipped", zap.Error(ctx.Err()))
+			break feed
+		}
+	}
+	close(shops)
+	wg.Wait()
+	return results
+}
+
+// shopContext — контекст начатого магазина: отмену ctx он не наследует, отмену w.work — наследует
+func (w *Worker) shopContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	shopCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(w.work, cancel)
+	return shopCtx, func() {
+		stop()
+		cancel()
 	}
 }
 
-func (w *Worker) ProcessAllShops(ctx context.Context) {
+func (w *Worker) safeRun(ctx context.Context, job string, shop config.Shop, fn func(ctx context.Context, shop config.Shop) RunResult) (run RunResult) {
+	started := w.clock.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			w.logger.Error("Shop processing panicked", zap.String("shop", shop.Name), zap.String("job", job), zap.Any("panic", p), zap.Stack("stack"))
+			run = RunResult{Shop: shop.Name, Job: job, Started: started, Error: fmt.Sprintf("panic: %v", p)}
+			w.finishRun(shop.Name, &run)
+		}
+	}()
+	return fn(ctx, shop)
+}
+
+// RunShop синхронно выполняет задачу JobTotals или JobItems для одного магазина и возвращает её итог
+func (w *Worker) RunShop(ctx context.Context, shopName, job string) (RunResult, error) {
 	for _, shop := range w.cfg.Shops {
-		w.logger.Info("Processing shop", zap.String("name", shop.Name))
+		if shop.Name != shopName {
+			continue
+		}
+		switch job {
+		case JobTotals:
+			return w.safeRun(ctx, job, shop, w.processShop), nil
+		case JobItems:
+			if shop.ItemsSheetRange == "" {
+				return RunResult{}, fmt.Errorf("shop %s has no ItemsSheetRange", shopName)
+			}
+			return w.safeRun(ctx, job, shop, w.processShopItems), nil
+		default:
+			return RunResult{}, fmt.Errorf("unknown job %q", job)
+		}
+	}
+	return RunResult{}, fmt.Errorf("shop %q not found in config", shopName)
+}
+
+// Outcomes — итоги по магазинам для истории запусков jobs.Runner
+func Outcomes(results []RunResult) []jobs.ShopOutcome {
+	res := make([]jobs.ShopOutcome, 0, len(results))
+	for _, r := range results {
+		res = append(res, jobs.ShopOutcome{Shop: r.Shop, Started: r.Started, Finished: r.Finished, Error: r.Error})
+	}
+	return res
+}
+
+// LastRuns — последние запуски по магазину и задаче
+func (w *Worker) LastRuns() map[string]map[string]RunResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make(map[string]map[string]RunResult, len(w.runs))
+	for shop, jobs := range w.runs {
+		res[shop] = make(map[string]RunResult, len(jobs))
+		for job, run := range jobs {
+			res[shop][job] = run
+		}
+	}
+	return res
+}
+
+func (w *Worker) finishRun(shopName string, run *RunResult) {
+	run.Finished = w.clock.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runs[shopName] == nil {
+		w.runs[shopName] = make(map[string]RunResult)
+	}
+	w.runs[shopName][run.Job] = *run
+}
+
+func (w *Worker) processShop(ctx context.Context, shop config.Shop) (run RunResult) {
+	run = RunResult{Shop: shop.Name, Job: JobTotals, Started: w.clock.Now()}
+	defer w.finishRun(shop.Name, &run)
+
+	if err := w.disabledErr(shop.Name, JobTotals); err != nil {
+		w.logger.Warn("Shop is disabled, skipping", zap.String("shop", shop.Name), zap.Error(err))
+		run.Error = err.Error()
+		return
+	}
 
-		metrics, err := w.avito.GetAvitoMetrics(shop.UserId, shop.ClientId, shop.ClientSecret)
+	w.logger.Info("Processing shop", zap.String("name", shop.Name))
+
+	metrics, err := w.avito.GetAvitoMetrics(ctx, w.runAccount(shop))
+	if err != nil {
+		w.handleAvitoError(shop, JobTotals, err)
+		run.Error = err.Error()
+		return
+	}
+	run.Metrics = &metrics
+	monitoring.ShopTotals(shop.Name, metrics.Spending, metrics.Impressions, metrics.Views, metrics.Contacts)
+
+	w.logger.Info("Successfully retrieved metrics", zap.String("shop", shop.Name), zap.Any("metrics", metrics))
+
+	if err := w.service.SaveTotals(ctx, shop.Name, metrics); err != nil {
+		w.logger.Error("Failed to save metrics", zap.String("shop", shop.Name), zap.Error(err))
+		monitoring.ShopFailed(shop.Name, JobTotals, "save")
+		run.Error = err.Error()
+		return
+	}
+	monitoring.ShopSucceeded(shop.Name, JobTotals, w.clock.Now())
+
+	w.logger.Info("Successfully saved metrics", zap.String("shop", shop.Name))
+	return
+}
+
+func (w *Worker) processShopItems(ctx context.Context, shop config.Shop) (run RunResult) {
+	run = RunResult{Shop: shop.Name, Job: JobItems, Started: w.clock.Now()}
+	defer w.finishRun(shop.Name, &run)
+
+	if err := w.disabledErr(shop.Name, JobItems); err != nil {
+		w.logger.Warn("Shop is disabled, skipping items", zap.String("shop", shop.Name), zap.Error(err))
+		run.Error = err.Error()
+		return
+	}
+
+	w.logger.Info("Processing shop items", zap.String("name", shop.Name))
+
+	items, err := w.avito.GetMetricsForAllItems(ctx, w.runAccount(shop), w.logger.With(zap.String("shop", shop.Name)))
+	if err != nil {
+		w.handleAvitoError(shop, JobItems, err)
+		run.Error = err.Error()
+		return
+	}
+	run.Items = len(items)
+	if w.cfg.Monitoring.PerItem {
+		monitoring.ResetItems(shop.Name)
+		for _, it := range items {
+			monitoring.ItemTotals(shop.Name, it.ID, it.Spending, it.Impressions, it.Views, it.Contacts)
+		}
+	}
+
+	if err := w.service.SaveItems(ctx, shop, items); err != nil {
+		w.logger.Error("Failed to save items", zap.String("shop", shop.Name), zap.Error(err))
+		monitoring.ShopFailed(shop.Name, JobItems, "save")
+		run.Error = err.Error()
+		return
+	}
+	monitoring.ShopSucceeded(shop.Name, JobItems, w.clock.Now())
+
+	w.logger.Info("Successfully saved items", zap.String("shop", shop.Name), zap.Int("items", len(items)))
+	return
+}
+
+// handleAvitoError логирует ошибку с её типом. При ошибке ключей или UserId магазин отключается целиком,
+// при 403 — только задача, чей эндпоинт недоступен: например, без прав на cpxpromo перестают работать
+// объявления, но не итоги. Так заведомо неуспешные запросы не повторяются каждый запуск
+func (w *Worker) handleAvitoError(shop config.Shop, job string, err error) {
+	monitoring.ShopFailed(shop.Name, job, avito.ErrorKind(err))
+
+	fields := []zap.Field{zap.String("shop", shop.Name), zap.String("job", job), zap.String("errorKind", avito.ErrorKind(err)), zap.Error(err)}
+
+	var rateErr *avito.RateLimitError
+	if errors.As(err, &rateErr) {
+		fields = append(fields, zap.Duration("retryAfter", rateErr.RetryAfter))
+	}
+
+	switch {
+	case avito.IsPermanent(err):
+		w.mu.Lock()
+		w.disabled[shop.Name] = err
+		w.mu.Unlock()
+		w.logger.Error("Shop disabled until restart, check its credentials and UserId in config", fields...)
+	case avito.IsForbidden(err):
+		w.mu.Lock()
+		w.disabled[disabledKey(shop.Name, job)] = err
+		w.mu.Unlock()
+		w.logger.Error("Shop job disabled until restart, check the scopes of the Avito app", fields...)
+	default:
+		w.logger.Error("Failed to get metrics", fields...)
+	}
+}
+
+// disabledErr — ошибка, из-за которой отключён магазин целиком или его задача job
+func (w *Worker) disabledErr(shopName, job string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.disabled[shopName]; err != nil {
+		return err
+	}
+	return w.disabled[disabledKey(shopName, job)]
+}
+
+func disabledKey(shopName, job string) string {
+	return shopName + "/" + job
+}
+
+// Backfill выгружает метрики за [from, to] с группировкой day/week/month в историю.
+// shopName == "" — все магазины из конфига
+func (w *Worker) Backfill(ctx context.Context, shopName string, from, to time.Time, grouping string) error {
+	found := false
+	var errs []error
+
+	for _, shop := range w.cfg.Shops {
+		if shopName != "" && shop.Name != shopName {
+			continue
+		}
+		found = true
+
+		w.logger.Info("Backfilling shop", zap.String("name", shop.Name), zap.Time("from", from), zap.Time("to", to), zap.String("grouping", grouping))
+
+		periods, err := w.avito.GetMetricsHistory(ctx, w.runAccount(shop), from, to, grouping)
 		if err != nil {
-			w.logger.Error("Failed to get metrics", zap.String("shop", shop.Name), zap.Error(err))
+			w.logger.Error("Failed to get metrics history", zap.String("shop", shop.Name), zap.String("errorKind", avito.ErrorKind(err)), zap.Error(err))
+			errs = append(errs, fmt.Errorf("shop %s: %w", shop.Name, err))
+			continue
+		}
+
+		if err := w.service.AppendHistory(ctx, shop.Name, grouping, periods); err != nil {
+			errs = append(errs, fmt.Errorf("shop %s: %w", shop.Name, err))
 			continue
 		}
 
-		w.logger.Info("Successfully retrieved metrics", zap.String("shop", shop.Name), zap.Any("metrics", metrics))
+		w.logger.Info("Shop backfilled", zap.String("shop", shop.Name), zap.Int("periods", len(periods)))
+	}
+
+	if !found {
+		return fmt.Errorf("shop %q not found in config", shopName)
+	}
+	return errors.Join(errs...)
+}
 
-		if err := w.service.UpdateSheet(ctx, shop.Name, metrics); err != nil {
-			w.logger.Error("Failed to update sheet", zap.String("shop", shop.Name), zap.Error(err))
+// TokenExpiries — время истечения токенов Avito по имени магазина, для диагностики
+func (w *Worker) TokenExpiries() map[string]time.Time {
+	res := make(map[string]time.Time, len(w.cfg.Shops))
+	for _, shop := range w.cfg.Shops {
+		if exp, ok := w.avito.TokenExpiry(shop.ClientId); ok {
+			res[shop.Name] = exp
 		}
+	}
+	return res
+}
 
-		w.logger.Info("Successfully updated sheet", zap.String("shop", shop.Name))
+// runAccount — учётные данные магазина на один запуск: с поясом магазина и общим на запуск бюджетом повторов
+func (w *Worker) runAccount(shop config.Shop) avito.Account {
+	acc := Account(shop, w.zones.Shop(shop.Name))
+	acc.Budget = w.avito.NewBudget(acc)
+	return acc
+}
 
-		time.Sleep(65 * time.Second)
+// Account — учётные данные магазина для клиента Avito. loc — пояс магазина, nil — clock.DefaultZone
+func Account(shop config.Shop, loc *time.Location) avito.Account {
+	return avito.Account{
+		Name:         shop.Name,
+		UserId:       shop.UserId,
+		ClientId:     shop.ClientId,
+		ClientSecret: shop.ClientSecret,
+		RetryBudget:  shop.RetryBudget,
+		Location:     loc,
 	}
 }
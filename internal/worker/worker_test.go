@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	"avitoproject/internal/client/avito/avitofake"
+	"avitoproject/internal/client/google/sheetsfake"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/metrics"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	promotionsPath = "/cpxpromo/1/getPromotionsByItemIds"
+	statsPath      = "/stats/v2/accounts/1/items"
+)
+
+type testEnv struct {
+	worker *Worker
+	avito  *avitofake.Server
+	sheets *sheetsfake.Sheets
+	clock  *clock.Fake
+	shop   config.Shop
+}
+
+// newTestEnv — worker поверх фейков Avito и Sheets с одним магазином, без повторов запросов
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnvWithRetry(t, avito.RetryPolicy{MaxAttempts: 1})
+}
+
+func newTestEnvWithRetry(t *testing.T, retry avito.RetryPolicy) *testEnv {
+	t.Helper()
+	shop := config.Shop{
+		Name: "main", ClientId: "client", ClientSecret: "secret", UserId: 1,
+		SheetRange: "Totals!B2:B5", ItemsSheetRange: "Items!A2:O",
+	}
+	cfg := config.Config{Shops: []config.Shop{shop}}
+	zones, err := cfg.Zones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		avito:  avitofake.NewServer(),
+		sheets: sheetsfake.New(),
+		clock:  clock.NewFake(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)),
+		shop:   shop,
+	}
+	env.avito.SetClock(env.clock)
+	env.avito.AddAccount(avitofake.Account{UserId: 1, ClientId: "client", ClientSecret: "secret",
+		Items: []avitofake.Item{{ID: 1, Title: "Sofa", Impressions: 100, Views: 10, Contacts: 1, Spending: 5000}}})
+	t.Cleanup(env.avito.Close)
+
+	logger := zap.NewNop()
+	repo := metrics.NewRepositoryMetrics(logger, cfg, zones, env.clock, env.sheets)
+	sink, err := metrics.NewFanOut(logger, cfg, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemState, _ := metrics.NewItemStateStore("")
+	snapState, _ := metrics.NewSnapshotStateStore("")
+	service := metrics.NewServiceMetrics(logger, cfg, zones, env.clock, sink, itemState, snapState)
+
+	client := avito.NewAvitoClient(logger, avito.Options{BaseUrl: env.avito.Start(), Retry: retry, Clock: env.clock})
+	env.worker = NewWorker(logger, client, service, cfg, zones, env.clock)
+	return env
+}
+
+func TestForbiddenDisablesOnlyTheFailingJob(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	// у приложения нет прав на cpxpromo: объявления падают с 403
+	env.avito.FailNext(promotionsPath, avitofake.Failure{Status: http.StatusForbidden, Body: "no scope"})
+	runs := env.worker.ProcessShopsItems(ctx, []config.Shop{env.shop})
+	if len(runs) != 1 || runs[0].Error == "" {
+		t.Fatalf("items run = %+v, want a forbidden error", runs)
+	}
+
+	// следующий запуск объявлений пропускается без запросов
+	runs = env.worker.ProcessShopsItems(ctx, []config.Shop{env.shop})
+	if len(runs) != 1 || runs[0].Error == "" {
+		t.Fatalf("second items run = %+v, want the job to stay disabled", runs)
+	}
+
+	// итоги магазина продолжают выгружаться
+	runs = env.worker.ProcessShops(ctx, []config.Shop{env.shop})
+	if len(runs) != 1 || runs[0].Error != "" {
+		t.Fatalf("totals run = %+v, want success", runs)
+	}
+	got, _ := env.sheets.ReadRange(ctx, "Totals!B2:B5")
+	if len(got) != 4 || got[1][0] != "100" {
+		t.Errorf("totals in sheet = %v, want impressions 100 in the second row", got)
+	}
+}
+
+func TestAuthErrorDisablesWholeShop(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	env.avito.FailNext("/token", avitofake.Failure{Status: http.StatusBadRequest, Body: "invalid client"})
+	if runs := env.worker.ProcessShops(ctx, []config.Shop{env.shop}); len(runs) != 1 || runs[0].Error == "" {
+		t.Fatalf("totals run = %+v, want an auth error", runs)
+	}
+
+	// ключи не поменялись — ни итоги, ни объявления больше не запрашиваются
+	issued := env.avito.TokensIssued()
+	if runs := env.worker.ProcessShopsItems(ctx, []config.Shop{env.shop}); len(runs) != 1 || runs[0].Error == "" {
+		t.Fatalf("items run = %+v, want the shop to stay disabled", runs)
+	}
+	if env.avito.TokensIssued() != issued {
+		t.Error("disabled shop still requested a token")
+	}
+}
+
+func TestStartedShopSurvivesStopButNotWorkCancel(t *testing.T) {
+	env := newTestEnvWithRetry(t, avito.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Minute})
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	env.worker.SetWorkContext(work)
+
+	// магазин начат и ждёт повтора запроса статистики
+	env.avito.FailNext(statsPath, avitofake.Failure{Status: http.StatusInternalServerError})
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan []RunResult, 1)
+	go func() { done <- env.worker.ProcessShops(ctx, []config.Shop{env.shop}) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for env.clock.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("shop did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// сигнал остановки не обрывает начатый магазин
+	stop()
+	select {
+	case runs := <-done:
+		t.Fatalf("run finished on stop: %+v", runs)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// таймаут остановки обрывает
+	cancelWork()
+	select {
+	case runs := <-done:
+		if len(runs) != 1 || runs[0].Error == "" {
+			t.Errorf("runs = %+v, want the shop cancelled", runs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop after the work context was cancelled")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/client/avito"
+	googleClient "avitoproject/internal/client/google"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/jobs"
+	"avitoproject/internal/metrics"
+	"avitoproject/internal/ratelimit"
+	"avitoproject/internal/worker"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Общие зависимости демона и разовых команд
+type app struct {
+	cfg     config.Config
+	zones   *clock.Zones
+	clock   clock.Clock
+	repo    *metrics.RepositoryMetrics // nil, если sink sheets не включён ни у одного магазина
+	service *metrics.ServiceMetrics
+	avito   *avito.AvitoClient
+	worker  *worker.Worker
+	runner  *jobs.Runner
+	closers []func() // освобождение ресурсов при остановке, в обратном порядке
+}
+
+// configError выводит каждую проблему конфига отдельной записью
+func configError(zapLogger *zap.Logger, err error) error {
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		for _, p := range verr.Problems {
+			zapLogger.Error("invalid config", zap.String("path", p.Path), zap.String("problem", p.Message))
+		}
+		return fmt.Errorf("config is invalid, run validate-config for details: %d problem(s)", len(verr.Problems))
+	}
+	return fmt.Errorf("failed to read config: %w", err)
+}
+
+// newApp собирает зависимости по конфигу. При ошибке уже открытые ресурсы закрываются
+func newApp(zapLogger *zap.Logger) (*app, error) {
+	// Конфиг
+	cfg, err := config.Read()
+	if err != nil {
+		return nil, configError(zapLogger, err)
+	}
+	for _, w := range cfg.Warnings() {
+		zapLogger.Warn("config warning", zap.String("path", w.Path), zap.String("problem", w.Message))
+	}
+	zones, err := cfg.Zones()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	a := &app{cfg: cfg, zones: zones, clock: clock.System}
+	if err := a.init(zapLogger); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *app) init(zapLogger *zap.Logger) error {
+	cfg, zones, clk := a.cfg, a.zones, a.clock
+
+	// Хранилища и сервис. Google клиент нужен только магазинам с sink sheets
+	var sinks []metrics.Sink
+	if cfg.UsesSink("sheets") {
+		gClient, err := googleClient.NewGoogleClient("service_account.json", cfg.SheetId, cfg.Timeouts.Sheets)
+		if err != nil {
+			return fmt.Errorf("failed to create Google client: %w", err)
+		}
+		a.repo = metrics.NewRepositoryMetrics(zapLogger, cfg, zones, clk, gClient)
+		sinks = append(sinks, a.repo)
+	}
+	if cfg.HistoryDir != "" {
+		history, err := metrics.NewRepositoryHistory(zapLogger, cfg.HistoryDir, clk)
+		if err != nil {
+			return fmt.Errorf("failed to open history store: %w", err)
+		}
+		sinks = append(sinks, history)
+	}
+	if cfg.Csv.Dir != "" {
+		csvSink, err := metrics.NewRepositoryCSV(zapLogger, cfg.Csv.Dir, clk)
+		if err != nil {
+			return fmt.Errorf("failed to open csv sink: %w", err)
+		}
+		sinks = append(sinks, csvSink)
+	}
+	if cfg.Webhook.Url != "" {
+		sinks = append(sinks, metrics.NewRepositoryWebhook(zapLogger, cfg.Webhook.Url, cfg.Webhook.Timeout, clk))
+	}
+	if cfg.Postgres.Dsn != "" {
+		pg, err := metrics.NewRepositoryPostgres(context.Background(), zapLogger, cfg.Postgres.Dsn, cfg.Postgres.Bucket, zones, clk)
+		if err != nil {
+			return fmt.Errorf("failed to open postgres sink: %w", err)
+		}
+		sinks = append(sinks, pg)
+		a.closers = append(a.closers, pg.Close)
+	}
+	fanOut, err := metrics.NewFanOut(zapLogger, cfg, sinks...)
+	if err != nil {
+		return fmt.Errorf("invalid sinks config: %w", err)
+	}
+
+	itemState, err := metrics.NewItemStateStore(cfg.ItemStatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open item state: %w", err)
+	}
+	snapState, err := metrics.NewSnapshotStateStore(cfg.SnapshotCatchUp.StatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot state: %w", err)
+	}
+	a.service = metrics.NewServiceMetrics(zapLogger, cfg, zones, clk, fanOut, itemState, snapState)
+
+	// Avito клиент
+	if a.avito, err = newAvitoClient(zapLogger, cfg, clk); err != nil {
+		return fmt.Errorf("failed to create Avito client: %w", err)
+	}
+
+	// Worker
+	a.worker = worker.NewWorker(zapLogger, a.avito, a.service, cfg, zones, clk)
+	a.runner = jobs.NewRunner(zapLogger, 0, clk)
+	return nil
+}
+
+func (a *app) Close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		a.closers[i]()
+	}
+}
+
+// newAvitoClient — клиент Avito по настройкам конфига, без Google и хранилищ
+func newAvitoClient(zapLogger *zap.Logger, cfg config.Config, clk clock.Clock) (*avito.AvitoClient, error) {
+	var tokens avito.TokenStore
+	if cfg.TokenCachePath != "" {
+		var err error
+		if tokens, err = avito.NewFileTokenStore(cfg.TokenCachePath); err != nil {
+			return nil, fmt.Errorf("failed to open token cache: %w", err)
+		}
+	}
+	limits := cfg.RateLimits()
+	return avito.NewAvitoClient(zapLogger, avito.Options{
+		BaseUrl: cfg.Urls.AvitoBaseUrl,
+		Tokens:  tokens,
+		Retry: avito.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			MaxDelay:    cfg.Retry.MaxDelay,
+			Budget:      cfg.Retry.Budget,
+		},
+		Limits:  ratelimit.NewGroup(limits.PerClient, limits.Global, clk),
+		Timeout: cfg.Timeouts.Avito,
+		Clock:   clk,
+	}), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"avitoproject/internal/client/avito"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// backfill --from 2025-01-01 --to 2025-01-31 [--grouping day|week|month] [--shop name]
+func runBackfill(zapLogger *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fromStr := fs.String("from", "", "first date, YYYY-MM-DD")
+	toStr := fs.String("to", "", "last date, YYYY-MM-DD (default: yesterday)")
+	grouping := fs.String("grouping", avito.GroupingDay, "day, week or month")
+	shop := fs.String("shop", "", "shop name (default: all shops)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *fromStr == "" {
+		return errors.New("--from is required")
+	}
+
+	a, err := newApp(zapLogger)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	// даты — в поясе магазина, без --shop — в общем поясе из конфига
+	loc := a.zones.Default()
+	if *shop != "" {
+		loc = a.zones.Shop(*shop)
+	}
+	from, to, err := backfillRange(*fromStr, *toStr, loc, a.clock.Now())
+	if err != nil {
+		return err
+	}
+	return a.worker.Backfill(context.Background(), *shop, from, to, *grouping)
+}
+
+// backfillRange разбирает --from и --to как даты в loc. Без --to выгрузка идёт по вчерашний день
+func backfillRange(fromStr, toStr string, loc *time.Location, now time.Time) (from, to time.Time, err error) {
+	from, err = time.ParseInLocation("2006-01-02", fromStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --from: %w", err)
+	}
+	to = now.In(loc).AddDate(0, 0, -1) // вчера
+	if toStr != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toStr, loc); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	return from, to, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"avitoproject/internal/clock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackfillRange(t *testing.T) {
+	vlad, err := clock.Load("Asia/Vladivostok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 17 октября 20:00 UTC во Владивостоке уже 18-е
+	now := time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to string
+		loc      *time.Location
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  string
+	}{
+		{name: "both dates", from: "2026-10-01", to: "2026-10-10", loc: time.UTC,
+			wantFrom: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "to defaults to yesterday", from: "2026-10-01", loc: time.UTC,
+			wantFrom: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC)},
+		{name: "dates in shop zone", from: "2026-10-01", loc: vlad,
+			wantFrom: time.Date(2026, 10, 1, 0, 0, 0, 0, vlad), wantTo: time.Date(2026, 10, 17, 6, 0, 0, 0, vlad)},
+		{name: "empty from", from: "", loc: time.UTC, wantErr: "invalid --from"},
+		{name: "bad month", from: "2026-13-01", loc: time.UTC, wantErr: "invalid --from"},
+		{name: "dotted date", from: "01.10.2026", loc: time.UTC, wantErr: "invalid --from"},
+		{name: "bad to", from: "2026-10-01", to: "2026-10-32", loc: time.UTC, wantErr: "invalid --to"},
+		{name: "datetime to", from: "2026-10-01", to: "2026-10-10T00:00:00Z", loc: time.UTC, wantErr: "invalid --to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := backfillRange(tt.from, tt.to, tt.loc, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(tt.wantFrom) || from.Location() != tt.loc {
+				t.Errorf("from = %s, want %s", from, tt.wantFrom)
+			}
+			if !to.Equal(tt.wantTo) || to.Location() != tt.loc {
+				t.Errorf("to = %s, want %s", to, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"avitoproject/config"
+	"avitoproject/internal/clock"
+	"avitoproject/internal/worker"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+type command struct {
+	usage string
+	run   func(zapLogger *zap.Logger, args []string) error
+}
+
+var commands = map[string]command{
+	"run":             {"run the daemon with schedulers (default)", runRun},
+	"fetch":           {"fetch --shop X [--items] [--format table|json] — print metrics without writing", runFetch},
+	"sync":            {"sync --shop X — fetch totals and write them once", runSync},
+	"items":           {"items --shop X — fetch item metrics and write them once", runItems},
+	"snapshot":        {"snapshot --shop X [--slot HH:MM] — refresh totals and save snapshots now", runSnapshot},
+	"backfill":        {"backfill --from YYYY-MM-DD [--to YYYY-MM-DD] [--grouping day|week|month] [--shop X]", runBackfill},
+	"validate-config": {"validate-config [--format text|json] — check config/config.json and exit", runValidateConfig},
+}
+
+// stdout — куда команды печатают результат, в тестах подменяется
+var stdout io.Writer = os.Stdout
+
+var commandOrder = []string{"run", "fetch", "sync", "items", "snapshot", "backfill", "validate-config"}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: avitotool <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
+
+func runRun(zapLogger *zap.Logger, args []string) error {
+	return runDaemon(zapLogger)
+}
+
+// fetch --shop X [--items] [--format table|json]
+func runFetch(zapLogger *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	shopName := fs.String("shop", "", "shop name")
+	items := fs.Bool("items", false, "print per-item metrics instead of totals")
+	format := fs.String("format", "table", "table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("invalid --format %q", *format)
+	}
+
+	// без Google и хранилищ: команда только читает Avito
+	cfg, err := config.Read()
+	if err != nil {
+		return err
+	}
+	shop, err := findShop(cfg, *shopName)
+	if err != nil {
+		return err
+	}
+	avitoClient, err := newAvitoClient(zapLogger, cfg, clock.System)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	zones, err := cfg.Zones()
+	if err != nil {
+		return err
+	}
+	acc := worker.Account(shop, zones.Shop(shop.Name))
+
+	if *items {
+		list, err := avitoClient.GetMetricsForAllItems(ctx, acc, zapLogger.With(zap.String("shop", shop.Name)))
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return printJSON(list)
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "ID\tImpressions\tViews\tContacts\tSpending, rub\tBid, penny\tTitle\t")
+		for _, it := range list {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%.2f\t%d\t%s\t\n", it.ID, it.Impressions, it.Views, it.Contacts, float64(it.Spending)/100, it.BidPenny, it.Title)
+		}
+		return tw.Flush()
+	}
+
+	data, err := avitoClient.GetAvitoMetrics(ctx, acc)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return printJSON(data)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Shop\tSpending, rub\tImpressions\tViews\tContacts\t")
+	fmt.Fprintf(tw, "%s\t%.2f\t%d\t%d\t%d\t\n", shop.Name, float64(data.Spending)/100, data.Impressions, data.Views, data.Contacts)
+	return tw.Flush()
+}
+
+// sync --shop X
+func runSync(zapLogger *zap.Logger, args []string) error {
+	return runShopJob(zapLogger, "sync", worker.JobTotals, args)
+}
+
+// items --shop X
+func runItems(zapLogger *zap.Logger, args []string) error {
+	return runShopJob(zapLogger, "items", worker.JobItems, args)
+}
+
+func runShopJob(zapLogger *zap.Logger, name, job string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	shopName := fs.String("shop", "", "shop name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *shopName == "" {
+		return errors.New("--shop is required")
+	}
+
+	a, err := newApp(zapLogger)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	run, err := a.worker.RunShop(context.Background(), *shopName, job)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(run); err != nil {
+		return err
+	}
+	if run.Error != "" {
+		return errors.New(run.Error)
+	}
+	return nil
+}
+
+// snapshot --shop X [--slot HH:MM]. Снапшот берётся из свежих итогов, поэтому сначала
+// выполняется та же выгрузка итогов, что и по расписанию
+func runSnapshot(zapLogger *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	shopName := fs.String("shop", "", "shop name")
+	slot := fs.String("slot", "", "snapshot slot HH:MM (default: all slots of the shop)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *shopName == "" {
+		return errors.New("--shop is required")
+	}
+
+	ctx := context.Background()
+	a, err := newApp(zapLogger)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	run, err := a.worker.RunShop(ctx, *shopName, worker.JobTotals)
+	if err != nil {
+		return err
+	}
+	if run.Error != "" {
+		return fmt.Errorf("unable to refresh totals: %s", run.Error)
+	}
+
+	saved, err := a.service.SaveSnapshotsNow(ctx, *shopName, *slot)
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return fmt.Errorf("shop %s has no snapshot slot %q", *shopName, *slot)
+	}
+	fmt.Fprintf(stdout, "saved %d snapshot(s)\n", saved)
+	return nil
+}
+
+// validate-config [--format text|json]
+func runValidateConfig(zapLogger *zap.Logger, args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	format := fs.String("format", "text", "text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid --format %q", *format)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	problems := []config.Problem{}
+	var verr *config.ValidationError
+	if err := cfg.Validate(); errors.As(err, &verr) {
+		problems = verr.Problems
+	} else if err != nil {
+		return err
+	}
+
+	warnings := cfg.Warnings()
+	if warnings == nil {
+		warnings = []config.Problem{}
+	}
+
+	if *format == "json" {
+		if err := printJSON(map[string]interface{}{"valid": len(problems) == 0, "problems": problems, "warnings": warnings}); err != nil {
+			return err
+		}
+	} else {
+		// по строке на ошибку, чтобы список читался без разбора JSON-лога
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, "warning:", w)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(stdout, "config is valid: %d shop(s)\n", len(cfg.Shops))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("config is invalid: %d problem(s)", len(problems))
+	}
+	return nil
+}
+
+func findShop(cfg config.Config, name string) (config.Shop, error) {
+	if name == "" {
+		return config.Shop{}, errors.New("--shop is required")
+	}
+	for _, shop := range cfg.Shops {
+		if shop.Name == name {
+			return shop, nil
+		}
+	}
+	return config.Shop{}, fmt.Errorf("shop %q not found in config", name)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
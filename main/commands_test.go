@@ -0,0 +1,154 @@
+package main
+
+import (
+	"avitoproject/config"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// captureStdout подменяет stdout команд буфером до конца теста
+func captureStdout(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := stdout
+	stdout = &buf
+	t.Cleanup(func() { stdout = prev })
+	return &buf
+}
+
+// writeConfig кладёт config/config.json в новый рабочий каталог теста
+func writeConfig(t *testing.T, body string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir(filepath.Join(dir, "config"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config", "config.json"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ошибки в аргументах находятся до чтения конфига: в каталоге теста его нет
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		wantErr string
+	}{
+		{command: "fetch", args: []string{"--shop", "main", "--format", "xml"}, wantErr: `invalid --format "xml"`},
+		{command: "fetch", args: []string{"--shop", "main", "--format="}, wantErr: `invalid --format ""`},
+		{command: "fetch", args: []string{"--shop"}, wantErr: "flag needs an argument: -shop"},
+		{command: "fetch", args: []string{"--verbose"}, wantErr: "flag provided but not defined: -verbose"},
+		{command: "sync", wantErr: "--shop is required"},
+		{command: "sync", args: []string{"--shop="}, wantErr: "--shop is required"},
+		{command: "items", args: []string{"--items"}, wantErr: "flag provided but not defined: -items"},
+		{command: "items", wantErr: "--shop is required"},
+		{command: "snapshot", args: []string{"--slot", "10:00"}, wantErr: "--shop is required"},
+		{command: "backfill", args: []string{"--to", "2026-10-01"}, wantErr: "--from is required"},
+		{command: "backfill", args: []string{"--from"}, wantErr: "flag needs an argument: -from"},
+		{command: "validate-config", args: []string{"--format", "yaml"}, wantErr: `invalid --format "yaml"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command+" "+strings.Join(tt.args, " "), func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			captureStdout(t)
+			err := commands[tt.command].run(zap.NewNop(), tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindShop(t *testing.T) {
+	cfg := config.Config{Shops: []config.Shop{{Name: "main"}, {Name: "second"}}}
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{name: "second"},
+		{name: "", wantErr: "--shop is required"},
+		{name: "Main", wantErr: `shop "Main" not found in config`},
+		{name: "third", wantErr: `shop "third" not found in config`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shop, err := findShop(cfg, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || shop.Name != tt.name {
+				t.Errorf("findShop = %q, %v, want %q", shop.Name, err, tt.name)
+			}
+		})
+	}
+}
+
+func TestValidateConfigJSON(t *testing.T) {
+	const shop = `{"Name": "main", "ClientId": "client", "ClientSecret": "secret", "UserId": 1, "SheetRange": "Totals!B2:B5"}`
+	tests := []struct {
+		name     string
+		config   string
+		valid    bool
+		problems []string // пути ошибок
+		warnings []string // пути предупреждений
+	}{
+		{name: "valid", config: `{"SheetId": "sheet", "Shops": [` + shop + `]}`, valid: true},
+		{name: "deprecated urls", config: `{"SheetId": "sheet", "Shops": [` + shop + `], "Urls": {"TokenUrl": "https://api.avito.ru/token"}}`,
+			valid: true, warnings: []string{"Urls.TokenUrl"}},
+		{name: "invalid", config: `{"Shops": [{"Name": "main", "UserId": 1}], "Timezone": "Mars/Olympus"}`,
+			problems: []string{"Shops[0].ClientId", "Shops[0].ClientSecret", "Shops[0].SheetRange", "SheetId", "Timezone"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, tt.config)
+			out := captureStdout(t)
+
+			err := runValidateConfig(zap.NewNop(), []string{"--format", "json"})
+			if tt.valid != (err == nil) {
+				t.Errorf("err = %v, want valid = %v", err, tt.valid)
+			}
+
+			var got struct {
+				Valid    bool             `json:"valid"`
+				Problems []config.Problem `json:"problems"`
+				Warnings []config.Problem `json:"warnings"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("output is not JSON: %v\n%s", err, out)
+			}
+			// пустые списки печатаются как [], а не null
+			if got.Problems == nil || got.Warnings == nil {
+				t.Errorf("problems and warnings must be arrays:\n%s", out)
+			}
+			if got.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v", got.Valid, tt.valid)
+			}
+			if paths := problemPaths(got.Problems); !reflect.DeepEqual(paths, tt.problems) {
+				t.Errorf("problems = %v, want %v", paths, tt.problems)
+			}
+			if paths := problemPaths(got.Warnings); !reflect.DeepEqual(paths, tt.warnings) {
+				t.Errorf("warnings = %v, want %v", paths, tt.warnings)
+			}
+		})
+	}
+}
+
+func problemPaths(problems []config.Problem) []string {
+	var paths []string
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"avitoproject/config"
-	"avitoproject/internal/client/avito"
-	googleClient "avitoproject/internal/client/google"
+	"avitoproject/internal/admin"
 	"avitoproject/internal/cron"
-	"avitoproject/internal/metrics"
-	"avitoproject/internal/worker"
+	"avitoproject/internal/monitoring"
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -20,37 +23,132 @@ func main() {
 		log.Fatalf("failed to create logger: %v", err)
 	}
 	defer zapLogger.Sync()
-	ctx := context.Background()
 
-	// Конфиг
-	cfg := config.Read()
+	// без аргументов — демон, как и раньше
+	name, args := "run", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
 
-	// Google клиент
-	gClient, err := googleClient.NewGoogleClient("service_account.json", cfg.SheetId)
-	if err != nil {
-		zapLogger.Fatal("failed to create Google client", zap.Error(err))
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(zapLogger, args); err != nil {
+		zapLogger.Error("command failed", zap.String("command", name), zap.Error(err))
+		zapLogger.Sync()
+		os.Exit(1)
 	}
+}
 
-	// Репозиторий и сервис
-	repo := metrics.NewRepositoryMetrics(zapLogger, cfg, gClient)
-	service := metrics.NewServiceMetrics(zapLogger, repo)
+const defaultShutdownTimeout = 30 * time.Second
 
-	// Avito клиент
-	avitoClient := avito.NewAvitoClient(zapLogger, cfg.Urls.TokenUrl, cfg.Urls.MetricsUrl)
+// cancelGrace — сколько после таймаута ждать, пока оборванные магазины вернутся,
+// прежде чем закрывать пул pg и приёмники
+const cancelGrace = 5 * time.Second
 
-	// Worker
-	w := worker.NewWorker(zapLogger, avitoClient, service, cfg)
+// runDaemon работает до SIGINT/SIGTERM, затем ждёт завершения запущенных задач не дольше ShutdownTimeout.
+// Ошибка — задачи не успели завершиться
+func runDaemon(zapLogger *zap.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a, err := newApp(zapLogger)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	// начатые магазины доделываются после сигнала, пока не выйдет ShutdownTimeout
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	a.worker.SetWorkContext(work)
 
 	// Cron scheduler
-	s := cron.NewScheduler(zapLogger, w)
-	if err = s.Start(ctx); err != nil {
-		zapLogger.Fatal("failed to start cron scheduler", zap.Error(err))
+	s := cron.NewScheduler(zapLogger, a.runner, a.worker, a.cfg, a.clock)
+
+	var adminServer *admin.Server
+	if a.cfg.Admin.Addr != "" {
+		if adminServer, err = admin.NewServer(zapLogger, a.cfg.Admin.Token, a.runner, s, a.worker, a.service, a.repo); err != nil {
+			return fmt.Errorf("failed to create admin API: %w", err)
+		}
 	}
-	defer s.Stop()
 
-	snapshotCron := cron.NewSnapshotScheduler(zapLogger, repo)
-	snapshotCron.Start(ctx)
-	defer snapshotCron.Stop()
+	if err := s.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start cron scheduler: %w", err)
+	}
 
-	select {}
+	snapshotCron := cron.NewSnapshotScheduler(zapLogger, a.runner, a.repo, a.service, a.cfg, a.clock)
+	if err := snapshotCron.Start(ctx); err != nil {
+		s.Stop(context.Background())
+		return fmt.Errorf("failed to start snapshot cron: %w", err)
+	}
+
+	if adminServer != nil {
+		go func() {
+			if err := adminServer.Serve(ctx, a.cfg.Admin.Addr); err != nil {
+				zapLogger.Error("admin API failed", zap.Error(err))
+			}
+		}()
+	}
+
+	if a.cfg.Monitoring.Addr != "" {
+		go func() {
+			if err := monitoring.Serve(ctx, zapLogger, a.cfg.Monitoring.Addr); err != nil {
+				zapLogger.Error("metrics server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	// повторный сигнал завершит процесс сразу, не дожидаясь задач
+	stop()
+
+	timeout := a.cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	zapLogger.Info("Shutdown signal received, waiting for running jobs", zap.Duration("timeout", timeout))
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stops := []func(context.Context) error{s.Stop, snapshotCron.Stop}
+	if adminServer != nil {
+		stops = append(stops, adminServer.Wait)
+	}
+	if err := waitAll(drainCtx, stops); err != nil {
+		// время вышло: обрываем начатую обработку магазинов и ждём, пока она вернётся,
+		// иначе отложенный a.Close закроет хранилища под пишущими магазинами
+		cancelWork()
+		graceCtx, cancelGraceCtx := context.WithTimeout(context.Background(), cancelGrace)
+		defer cancelGraceCtx()
+		if graceErr := waitAll(graceCtx, stops); graceErr != nil {
+			zapLogger.Warn("Cancelled jobs did not return, closing anyway", zap.Error(graceErr))
+		}
+		return fmt.Errorf("shutdown timed out: %w", err)
+	}
+
+	zapLogger.Info("Shutdown complete")
+	return nil
+}
+
+// waitAll вызывает остановки одновременно, чтобы общий таймаут не удваивался, и собирает их ошибки
+func waitAll(ctx context.Context, stops []func(context.Context) error) error {
+	errs := make(chan error, len(stops))
+	for _, fn := range stops {
+		go func() { errs <- fn(ctx) }()
+	}
+	var err error
+	for range stops {
+		err = errors.Join(err, <-errs)
+	}
+	return err
 }